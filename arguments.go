@@ -4,9 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 
@@ -15,41 +15,54 @@ import (
 
 // arguments structure
 type Args struct {
-	NxgLnk          string `arg:"positional" help:"Fully qualified NXGLNK URI (nxglnk://?h=header&t=title&p=password)"`
-	Header          string `arg:"--header" help:"Header to be downloaded" placeholder:"STRING"`
-	Password        string `arg:"--password" help:"Password to extract the downloaded rar file" placeholder:"STRING"`
-	Title           string `arg:"--title" help:"Title of the download" placeholder:"STRING"`
-	Register        bool   `arg:"--register" help:"Register the NXGLNK scheme"`
-	Host            string `arg:"--host" help:"Usenet server host name or IP address" placeholder:"HOST"`
-	Port            int    `arg:"--port" help:"Usenet server port number" placeholder:"INT"`
-	SSL             bool   `arg:"-"`
-	SSL_arg         string `arg:"--ssl" help:"Use SSL" placeholder:"true|false"`
-	NntpUser        string `arg:"--user" help:"Username to connect to the usenet server" placeholder:"STRING"`
-	NntpPass        string `arg:"--pass" help:"Password to connect to the usenet server" placeholder:"STRING"`
-	Connections     int    `arg:"--connections" help:"Ammount of connections to use to connect to the usenet server" placeholder:"INT"`
-	ConnRetries     int    `arg:"--connretries" help:"Number of retries upon connection error" placeholder:"INT"`
-	ConnWaitTime    int    `arg:"--connwaittime" help:"Time to wait in seconds before trying to re-connect" placeholder:"INT"`
-	Retries         int    `arg:"--retries" help:"Number of retries before article reading fails" placeholder:"INT"`
-	Repair          bool   `arg:"-"`
-	Repair_arg      string `arg:"--repair" help:"Repair downloaded files using the par2 files" placeholder:"true|false"`
-	DeletePar2      bool   `arg:"-"`
-	DeletePar2_arg  string `arg:"--delpar2" help:"Delete par2 files after successful repair or if no repair needed" placeholder:"true|false"`
-	Par2Exe         string `arg:"--par2exe" help:"Path to the par2.exe" placeholder:"PATH"`
-	Unrar           bool   `arg:"-"`
-	Unrar_arg       string `arg:"--unrar" help:"Automatically extract the downloaded rar files" placeholder:"true|false"`
-	DeleteRar       bool   `arg:"-"`
-	DeleteRar_arg   string `arg:"--delrar" help:"Delete rar files after successful unrar" placeholder:"true|false"`
-	RarExe          string `arg:"--rarexe" help:"Path to the unrar.exe" placeholder:"PATH"`
-	TempPath        string `arg:"--temp" help:"Temporary path for the downloaded files" placeholder:"PATH"`
-	DestPath        string `arg:"--dest" help:"Final destination path for the downloaded files" placeholder:"PATH"`
-	LogFilePath     string `arg:"--log" help:"Path for the log file" placeholder:"PATH"`
-	Verbose         int    `arg:"--verbose" help:"Verbosity level of cmd output" placeholder:"0-3"`
-	Debug           bool   `arg:"-"`
-	Debug_arg       string `arg:"--debug" help:"Activate debug mode" placeholder:"true|false"`
-	Test            string `arg:"--test" help:"Activate test mode and read messages from PATH instead from usenet" placeholder:"PATH"`
-	EndWaitTime     bool   `arg:"-"`
-	SuccessWaitTime int    `arg:"-"`
-	ErrorWaitTime   int    `arg:"-"`
+	NxgLnk          string                 `arg:"-"`
+	Header          string                 `arg:"--header" help:"Header to be downloaded" placeholder:"STRING"`
+	Password        string                 `arg:"--password" help:"Password to extract the downloaded rar file" placeholder:"STRING"`
+	Title           string                 `arg:"--title" help:"Title of the download" placeholder:"STRING"`
+	Category        string                 `arg:"--category" help:"Category of the download" placeholder:"NAME"`
+	Subfolder       string                 `arg:"--subfolder" help:"Subfolder of the destination path for the download" placeholder:"PATH"`
+	Priority        string                 `arg:"--priority" help:"Priority of the download in the download queue" placeholder:"low|normal|high"`
+	Profile         string                 `arg:"--profile" help:"Name of the configuration profile to use" placeholder:"NAME"`
+	Profiles        map[string]interface{} `arg:"-"`
+	Categories      map[string]Category    `arg:"-"`
+	StorePass       string                 `arg:"--storepass" help:"Prompt for a password and store it in the keyring or the encrypted credentials file" placeholder:"keyring:NAME|credfile:NAME"`
+	Server          `mapstructure:",squash"`
+	Servers         []Server `arg:"-"`
+	ConnRetries     int      `arg:"--connretries" help:"Number of retries upon connection error" placeholder:"INT"`
+	ConnWaitTime    Duration `arg:"--connwaittime" help:"Time to wait before trying to re-connect" placeholder:"DURATION"`
+	Retries         int      `arg:"--retries" help:"Number of retries before article reading fails" placeholder:"INT"`
+	DialTimeout     Duration `arg:"--dialtimeout" help:"Timeout for establishing a connection to the usenet server" placeholder:"DURATION"`
+	AuthTimeout     Duration `arg:"--authtimeout" help:"Timeout for the authentication with the usenet server" placeholder:"DURATION"`
+	ReadTimeout     Duration `arg:"--readtimeout" help:"Time without data from the usenet server before the article is requeued and the connection is re-established" placeholder:"DURATION"`
+	StallTime       Duration `arg:"--stalltime" help:"Time without data from the usenet server before a connection is reported as stalled" placeholder:"DURATION"`
+	Repair          bool     `arg:"--repair" help:"Repair downloaded files using the par2 files"`
+	DeletePar2      bool     `arg:"--delpar2" help:"Delete par2 files after successful repair or if no repair needed"`
+	Par2Exe         string   `arg:"--par2exe" help:"Path to the par2.exe" placeholder:"PATH"`
+	Unrar           bool     `arg:"--unrar" help:"Automatically extract the downloaded rar files"`
+	DeleteRar       bool     `arg:"--delrar" help:"Delete rar files after successful unrar"`
+	RarExe          string   `arg:"--rarexe" help:"Path to the unrar.exe" placeholder:"PATH"`
+	TempPath        string   `arg:"--temp" help:"Temporary path for the downloaded files" placeholder:"PATH"`
+	DestPath        string   `arg:"--dest" help:"Final destination path for the downloaded files" placeholder:"PATH"`
+	MinFreeSpace    Size     `arg:"--minfreespace" help:"Free disk space required in addition to the download, the download is paused if less space is left" placeholder:"SIZE"`
+	SpeedLimit      Size     `arg:"--speedlimit" help:"Maximum download speed per second of all connections together (0 = unlimited)" placeholder:"SIZE"`
+	CachePath       string   `arg:"--cache" help:"Path of the article cache shared by all downloads (empty = no cache)" placeholder:"PATH"`
+	CacheSize       Size     `arg:"--cachesize" help:"Maximum size of the article cache, the least recently used articles are deleted (0 = unlimited)" placeholder:"SIZE"`
+	ArticleOrder    string   `arg:"--order" help:"Order the articles are loaded in: sequential or the first and last article of every file first" placeholder:"sequential|edges"`
+	Par2IndexFirst  bool     `arg:"--par2first" help:"Load the par2 index file before the data files to verify the data files while they are downloaded"`
+	PriorityFiles   []string `arg:"--priorityfile,separate" help:"Pattern (e.g. \"*.mkv\") of the files loaded first (can be repeated)" placeholder:"PATTERN"`
+	ConflictPolicy  string   `arg:"--conflict" help:"Handling of files that already exist in the destination path" placeholder:"skip|overwrite|rename|hash"`
+	LogFilePath     string   `arg:"--log" help:"Path for the log file" placeholder:"PATH"`
+	WatchFolders    []string `arg:"-"`
+	Output          string   `arg:"--output" help:"Format of the output: text or newline-delimited JSON events" placeholder:"text|json"`
+	Verbose         int      `arg:"--verbose" help:"Verbosity level of cmd output" placeholder:"0-3"`
+	Debug           bool     `arg:"--debug" help:"Activate debug mode"`
+	Test            string   `arg:"--test" help:"Activate test mode and read messages from PATH instead from usenet" placeholder:"PATH"`
+	TUI             bool     `arg:"--tui" help:"Show the full-screen terminal interface with the state of the connections and files"`
+	Notify          bool     `arg:"--notify" help:"Show desktop notifications when the download starts, completes or fails"`
+	Headless        bool     `arg:"-"`
+	EndWaitTime     bool     `arg:"-"`
+	SuccessWaitTime Duration `arg:"-"`
+	ErrorWaitTime   Duration `arg:"-"`
 }
 
 // version information
@@ -59,7 +72,11 @@ func (Args) Version() string {
 
 // additional description
 func (Args) Epilogue() string {
-	return "\nParameters that are passed as arguments have precedence over the settings in the configuration file and the NXGLNK (if provided).\n"
+	return "\nThe options can be used with every command (e.g. \"nxg-loader check --header HEADER\").\n" +
+		"Parameters that are passed as arguments have precedence over the NXGLNK (if provided), the environment variables, the selected profile and the settings in the configuration file (in this order).\n" +
+		"Every setting of the configuration file can also be set with an environment variable NXG_<SETTING> (e.g. NXG_HOST) and NXG_SERVERS_<n>_<SETTING> for the servers list.\n" +
+		"Boolean settings can be disabled with --no-<OPTION> (e.g. --no-unrar), durations are given in seconds or with unit (e.g. 1m30s).\n" +
+		"Set NXG_HEADLESS=true to run without a configuration file (e.g. in a container).\n"
 }
 
 // parser variable
@@ -67,13 +84,16 @@ var argParser *parser.Parser
 
 func parseArguments() {
 
-	parserConfig := parser.Config{
-		IgnoreEnv: true,
-	}
+	args := withDefaultCommand(os.Args[1:])
 
 	// parse flags
-	argParser, _ = parser.NewParser(parserConfig, &conf)
-	if err := parser.Parse(&conf); err != nil {
+	args, err := normalizeArgs(args)
+	if err != nil {
+		writeUsage(newArgParser())
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
+	}
+	if err := parseArgs(args); err != nil {
 		if err.Error() == "help requested by user" {
 			writeHelp(argParser)
 			fmt.Println(conf.Epilogue())
@@ -84,55 +104,143 @@ func parseArguments() {
 		}
 		writeUsage(argParser)
 		Log.Error(err.Error())
-		os.Exit(1)
+		os.Exit(exitInvalidInput)
 	}
+	command = strings.Join(argParser.SubcommandNames(), " ")
+	recordArgumentSources(args)
 
+	// apply the selected configuration profile
+	if err := applyProfile(args); err != nil {
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
+	}
+
+}
+
+// parseArgs parses the arguments into the current configuration
+// lists cannot be used as defaults of the arguments, so they are only replaced if passed as arguments
+func parseArgs(args []string) error {
+	tlsPins, priorityFiles := conf.TLSPins, conf.PriorityFiles
+	conf.TLSPins, conf.PriorityFiles = nil, nil
+	commands = Commands{}
+	argParser = newArgParser()
+	err := argParser.Parse(args)
+	if conf.TLSPins == nil {
+		conf.TLSPins = tlsPins
+	}
+	if conf.PriorityFiles == nil {
+		conf.PriorityFiles = priorityFiles
+	}
+	conf.NxgLnk = commands.nxgLnk()
+	return err
+}
+
+// newArgParser creates the parser for the arguments
+// the current configuration values are used as the defaults of the arguments
+func newArgParser() *parser.Parser {
+	parserConfig := parser.Config{
+		IgnoreEnv: true,
+	}
+	argParser, _ := parser.NewParser(parserConfig, &commands, &conf)
+	return argParser
+}
+
+// runConfigCommand creates, checks or shows the configuration
+func runConfigCommand() {
+	parseNxgLnk()
+	switch {
+	case commands.Config.Init != nil:
+		if _, err := os.Stat(filepath.Join(confFilePath, configFileName)); err == nil && !commands.Config.Init.Force {
+			Log.Error("Configuration file \"%v\" already exists (use --force to overwrite it)", filepath.Join(confFilePath, configFileName))
+			os.Exit(exitInvalidInput)
+		}
+		if err := writeDefaultConfig(); err != nil {
+			Log.Error("Error creating configuration file: %v", err)
+			os.Exit(1)
+		}
+		Log.Info("Configuration file \"%v\" created.", filepath.Join(confFilePath, configFileName))
+	case commands.Config.Check != nil:
+		ok := checkConfig()
+		if ok {
+			// also check that the passwords can be resolved
+			if err := initServers(); err != nil {
+				Log.Error(err.Error())
+				ok = false
+			}
+		}
+		if !ok {
+			os.Exit(exitInvalidInput)
+		}
+		Log.Succ("Configuration \"%v\" is valid", filepath.Join(confFilePath, configFileName))
+	case commands.Config.Show != nil:
+		showConfig()
+	default:
+		writeHelp(argParser)
+		os.Exit(exitInvalidInput)
+	}
+	os.Exit(0)
 }
 
 func checkArguments() {
 
-	// check --register flag
-	if conf.Register {
-		registerProtocol()
+	checkGeneralArguments()
+
+	if err := loadQueueItem(); err != nil {
+		Log.Error("Unable to load the queued download: %v", err)
+		os.Exit(exitInvalidInput)
 	}
 
 	if conf.Header == "" && conf.NxgLnk == "" {
 		Log.Error("You must provide either the --header argument or a NXGLNK URI")
-		os.Exit(1)
-	}
-
-	// parse nxglnk if provided
-	if conf.NxgLnk != "" {
-		if nxglnk, err := url.Parse(conf.NxgLnk); err == nil {
-			if nxglnk.Scheme == "nxglnk" {
-				if query, err := url.ParseQuery(nxglnk.RawQuery); err == nil {
-					if h := query.Get("h"); h != "" && conf.Header == "" {
-						conf.Header = strings.TrimSpace(h)
-					} else {
-						writeUsage(argParser)
-						Log.Error("Invalid NXGLNK URI: missing 'h' parameter")
-						os.Exit(1)
-					}
-					if t := query.Get("t"); t != "" && conf.Title == "" {
-						conf.Title = strings.TrimSpace(t)
-					}
-					if p := query.Get("p"); p != "" && conf.Password == "" {
-						conf.Password = strings.TrimSpace(p)
-					}
-				}
-			} else {
-				writeUsage(argParser)
-				Log.Error("Invalid NXGLNK URI")
-				os.Exit(1)
-			}
+		os.Exit(exitInvalidInput)
+	}
+
+	parseNxgLnk()
+	decodeHeader()
+	if err := applyCategory(); err != nil {
+		writeUsage(argParser)
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
+	}
+
+	checkDownloadConfig()
+	setDownloadPaths()
+}
+
+// checkGeneralArguments handles the --storepass flag and warns about insecure arguments
+func checkGeneralArguments() {
+
+	// check --storepass flag
+	if conf.StorePass != "" {
+		if err := storeCredential(conf.StorePass); err != nil {
+			Log.Error("Unable to store password: %v", err)
+			os.Exit(1)
 		}
+		Log.Info("Password stored. Use \"NntpPassRef: %v\" in the configuration file to use it.", conf.StorePass)
+		os.Exit(0)
+	}
+
+	// warn about passwords passed as argument
+	for _, arg := range os.Args[1:] {
+		if arg == "--pass" || strings.HasPrefix(arg, "--pass=") {
+			Log.Warn("Passwords passed with --pass are visible in the process list, consider using --passref instead")
+		}
+	}
+}
+
+// checkDownloadConfig validates the configuration of the downloads, the paths and the usenet servers
+func checkDownloadConfig() {
+
+	// validate the configuration
+	if !checkConfig() {
+		os.Exit(exitInvalidInput)
 	}
 
 	// check paths
 	if conf.DestPath == "" {
 		writeUsage(argParser)
 		Log.Error("No destination path provided")
-		os.Exit(1)
+		os.Exit(exitInvalidInput)
 	}
 	if conf.TempPath == "" {
 		conf.TempPath = os.TempDir()
@@ -141,18 +249,32 @@ func checkArguments() {
 	if !filepath.IsAbs(conf.TempPath) {
 		if conf.TempPath, err = filepath.Abs(filepath.Join(homePath, conf.TempPath)); err != nil {
 			Log.Error("Unable to determine temporary path: ", err)
-			os.Exit(1)
+			os.Exit(exitInvalidInput)
 		}
 	}
 	if !filepath.IsAbs(conf.DestPath) {
 		if conf.DestPath, err = filepath.Abs(filepath.Join(homePath, conf.DestPath)); err != nil {
 			Log.Error("Unable to determine destination path: ", err)
-			os.Exit(1)
+			os.Exit(exitInvalidInput)
 		}
 	}
 	if conf.TempPath == conf.DestPath {
 		Log.Error("Temporary path and destination path must be different")
-		os.Exit(1)
+		os.Exit(exitInvalidInput)
+	}
+
+	// check usenet servers
+	if err = initServers(); err != nil {
+		writeUsage(argParser)
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
+	}
+}
+
+// setDownloadPaths adds the subfolder and the title (or the header) of the download to the paths
+func setDownloadPaths() {
+	if conf.Subfolder != "" {
+		conf.DestPath = filepath.Join(conf.DestPath, filepath.FromSlash(conf.Subfolder))
 	}
 	if conf.Title != "" {
 		// sanitize title
@@ -163,50 +285,41 @@ func checkArguments() {
 		conf.TempPath = filepath.Join(conf.TempPath, conf.Header)
 		conf.DestPath = filepath.Join(conf.DestPath, conf.Header)
 	}
+}
 
-	// check bools
-	if conf.SSL_arg != "" {
-		if conf.SSL_arg == "true" {
-			conf.SSL = true
-		} else if conf.SSL_arg == "false" {
-			conf.SSL = false
-		}
-	}
-	if conf.Repair_arg != "" {
-		if conf.Repair_arg == "true" {
-			conf.Repair = true
-		} else if conf.Repair_arg == "false" {
-			conf.Repair = false
-		}
-	}
-	if conf.DeletePar2_arg != "" {
-		if conf.DeletePar2_arg == "true" {
-			conf.DeletePar2 = true
-		} else if conf.DeletePar2_arg == "false" {
-			conf.DeletePar2 = false
-		}
+// parseNxgLnk takes the settings from the NXGLNK (if provided)
+// unless they are passed as arguments
+func parseNxgLnk() {
+	if err := applyNxgLnk(); err != nil {
+		writeUsage(argParser)
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
 	}
-	if conf.Unrar_arg != "" {
-		if conf.Unrar_arg == "true" {
-			conf.Unrar = true
-		} else if conf.Unrar_arg == "false" {
-			conf.Unrar = false
-		}
+}
+
+func applyNxgLnk() error {
+	if conf.NxgLnk == "" {
+		return nil
 	}
-	if conf.DeleteRar_arg != "" {
-		if conf.DeleteRar_arg == "true" {
-			conf.DeleteRar = true
-		} else if conf.DeleteRar_arg == "false" {
-			conf.DeleteRar = false
-		}
+	link, err := parseNxgLink(conf.NxgLnk)
+	if err != nil {
+		return err
 	}
-	if conf.Debug_arg != "" {
-		if conf.Debug_arg == "true" {
-			conf.Debug = true
-		} else if conf.Debug_arg == "false" {
-			conf.Debug = false
+	parsedLink = link
+	for key, value := range map[string]*string{
+		"Header":    &link.Header,
+		"Title":     &link.Title,
+		"Password":  &link.Password,
+		"Category":  &link.Category,
+		"Subfolder": &link.Subfolder,
+		"Priority":  &link.Priority,
+	} {
+		if *value != "" && configSources[key] != "flag" {
+			reflect.ValueOf(&conf).Elem().FieldByName(key).SetString(*value)
+			configSources[key] = "NXGLNK"
 		}
 	}
+	return nil
 }
 
 func writeUsage(parser *parser.Parser) {
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// result of a download of the batch
+const (
+	batchResultCompleted = "completed"
+	batchResultRepaired  = "repaired"
+	batchResultFailed    = "failed"
+	batchResultPending   = "not started"
+)
+
+// download of the batch
+type batchItem struct {
+	NxgLnk   string
+	Header   string
+	Title    string
+	Password string
+	result   string
+	err      error
+}
+
+// downloads of the batch command
+var batchItems []*batchItem
+
+// settings that are reset before every download of the batch
+// the other settings are shared by all downloads, the connections read them meanwhile
+var batchDownloadKeys = []string{"NxgLnk", "Header", "Title", "Password", "Category", "Subfolder", "Priority", "DestPath", "TempPath", "Repair", "DeletePar2", "Unrar", "DeleteRar"}
+
+// parseBatchItem parses a NXGLNK or a line with header, title and password separated by tabs
+func parseBatchItem(line string) *batchItem {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(strings.ToLower(line), "nxglnk:") {
+		return &batchItem{NxgLnk: line, result: batchResultPending}
+	}
+	fields := strings.Split(line, "\t")
+	item := &batchItem{Header: strings.TrimSpace(fields[0]), result: batchResultPending}
+	if len(fields) > 1 {
+		item.Title = strings.TrimSpace(fields[1])
+	}
+	if len(fields) > 2 {
+		item.Password = strings.TrimSpace(fields[2])
+	}
+	return item
+}
+
+// readBatchItems reads the downloads from the reader, one per line
+// empty lines and lines starting with # are ignored
+func readBatchItems(r io.Reader) ([]*batchItem, error) {
+	var items []*batchItem
+	scanner := bufio.NewScanner(r)
+	// headers may be long
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, parseBatchItem(line))
+	}
+	return items, scanner.Err()
+}
+
+// batchItemsFromArguments collects the downloads from the arguments, the file and stdin
+func batchItemsFromArguments() ([]*batchItem, error) {
+	var items []*batchItem
+	readFile := func(path string) error {
+		var r io.Reader = os.Stdin
+		if path != "-" {
+			file, err := os.Open(workRelativePath(path))
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+		fileItems, err := readBatchItems(r)
+		if err != nil {
+			return fmt.Errorf("unable to read \"%v\": %v", path, err)
+		}
+		items = append(items, fileItems...)
+		return nil
+	}
+	for _, arg := range commands.Batch.Items {
+		if arg == "-" {
+			if err := readFile("-"); err != nil {
+				return nil, err
+			}
+		} else if arg = strings.TrimSpace(arg); arg != "" {
+			items = append(items, parseBatchItem(arg))
+		}
+	}
+	if commands.Batch.File != "" {
+		if err := readFile(commands.Batch.File); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// runBatchCommand downloads the downloads one after another with the same connections
+func runBatchCommand() {
+	checkGeneralArguments()
+
+	var err error
+	if batchItems, err = batchItemsFromArguments(); err != nil {
+		Log.Error("Unable to read the downloads: %v", err)
+		os.Exit(exitInvalidInput)
+	}
+	if len(batchItems) == 0 {
+		writeUsage(argParser)
+		Log.Error("No downloads provided")
+		os.Exit(exitInvalidInput)
+	}
+	checkDownloadConfig()
+	base := conf
+	for _, key := range []string{"Header", "Title", "Password"} {
+		if configSources[key] == "flag" {
+			Log.Warn("--%v is ignored by the batch command, every download has its own", strings.ToLower(key))
+			configSources[key] = "default"
+		}
+	}
+	baseSources := maps.Clone(configSources)
+	startTUI()
+
+	for i, item := range batchItems {
+		// every download starts with the same configuration
+		for _, key := range batchDownloadKeys {
+			reflect.ValueOf(&conf).Elem().FieldByName(key).Set(reflect.ValueOf(base).FieldByName(key))
+		}
+		conf.Header, conf.Title, conf.Password = item.Header, item.Title, item.Password
+		conf.NxgLnk = item.NxgLnk
+		configSources = maps.Clone(baseSources)
+		parsedLink = nxgLink{}
+
+		newline()
+		Log.Info("Download %d of %d", i+1, len(batchItems))
+		item.result, item.err = batchResultFailed, nil
+		if item.err = applyNxgLnk(); item.err == nil {
+			// the connections and all other settings are shared by the downloads
+			if parsedLink.Profile != "" && !strings.EqualFold(parsedLink.Profile, conf.Profile) {
+				item.err = fmt.Errorf("the profile \"%v\" of the NXGLNK cannot be used by the batch command, run the batch command with --profile %v instead", parsedLink.Profile, parsedLink.Profile)
+			} else if item.err = readHeader(); item.err == nil {
+				item.err = applyCategory()
+			}
+		}
+		if item.err != nil {
+			item.err = withExitCode(exitInvalidInput, item.err)
+			Log.Error("Invalid download: %v", item.err)
+			emitResult(exitInvalidInput, item.err)
+			continue
+		}
+		// the title of the NXGLNK is shown in the summary
+		item.Header, item.Title = conf.Header, conf.Title
+		setDownloadPaths()
+
+		Log.Info("Downloading \"%v\"", downloadName())
+		repaired, err := downloadFiles()
+		Log.Debug("Deleting temporary folder \"%v\"", conf.TempPath)
+		if err := os.RemoveAll(conf.TempPath); err != nil {
+			Log.Warn("Error while deleting temporary folder: %v", err)
+		}
+		runCategoryScript(err == nil)
+		switch {
+		case err != nil:
+			item.err = err
+			Log.Error("Download failed: %v", err)
+			emitResult(exitCodeOf(err), err)
+		case repaired:
+			item.result = batchResultRepaired
+			Log.Succ("Download successful")
+			emitResult(exitRepaired, nil)
+		default:
+			item.result = batchResultCompleted
+			Log.Succ("Download successful")
+			emitResult(exitSuccess, nil)
+		}
+	}
+
+	stopTUI()
+	exitCode := showBatchSummary()
+	os.Exit(exitCode)
+}
+
+// showBatchSummary shows the result of every download of the batch
+// the exit code is the one of the first failed download, or exitRepaired if a download had to be repaired
+func showBatchSummary() int {
+	exitCode := exitSuccess
+	completed := 0
+	w := tabwriter.NewWriter(io.Discard, 0, 0, 2, ' ', 0)
+	if !jsonOutput() {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	}
+	fmt.Fprintln(w, "#\tRESULT\tTITLE\tERROR")
+	for i, item := range batchItems {
+		var message string
+		if item.err != nil {
+			message = item.err.Error()
+		}
+		switch {
+		case item.result == batchResultCompleted || item.result == batchResultRepaired:
+			completed++
+			if item.result == batchResultRepaired && exitCode == exitSuccess {
+				exitCode = exitRepaired
+			}
+		case successful(exitCode):
+			exitCode = exitCodeOf(item.err)
+			if item.err == nil {
+				exitCode = exitFailed
+			}
+		}
+		fmt.Fprintf(w, "%d\t%v\t%v\t%v\n", i+1, item.result, item.name(), message)
+	}
+	w.Flush()
+	if !jsonOutput() {
+		fmt.Println()
+	}
+	emitEvent("summary", map[string]interface{}{"successful": completed, "total": len(batchItems), "exitCode": exitCode})
+	if successful(exitCode) {
+		Log.Succ("%d of %d downloads successful", completed, len(batchItems))
+	} else {
+		Log.Error("%d of %d downloads successful", completed, len(batchItems))
+	}
+	notify("Batch finished", fmt.Sprintf("%d of %d downloads successful", completed, len(batchItems)))
+	return exitCode
+}
+
+func (i *batchItem) name() string {
+	name := i.Title
+	if name == "" {
+		name = i.Header
+	}
+	if name == "" {
+		name = i.NxgLnk
+	}
+	if i.Title == "" && len(name) > 40 {
+		return name[:40] + "..."
+	}
+	return name
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chrisfarms/yenc"
+)
+
+// extension of the files of the article cache
+const cacheFileExt = ".part"
+
+// meta data of a cached part, written as first line of the cache file followed by the decoded body
+type cachedPart struct {
+	MessageID string
+	Name      string
+	Number    int
+	Size      int64
+	Begin     int64
+	End       int64
+	FileSize  int64
+}
+
+// ArticleCache stores the decoded parts of the articles in a directory shared by all downloads,
+// the file of a part is named by the hash of its message id
+// the least recently used parts are deleted if the cache exceeds its size limit
+type ArticleCache struct {
+	mu     sync.Mutex
+	path   string
+	limit  int64 // 0 = unlimited
+	size   int64 // current size of the cache, -1 until the cache directory was read
+	hits   int
+	misses int
+}
+
+var articleCache = ArticleCache{size: -1}
+
+// enabled returns true if a cache path is configured
+func (c *ArticleCache) enabled() bool {
+	return conf.CachePath != ""
+}
+
+// file returns the path of the cache file of the message id
+func (c *ArticleCache) file(messageID string) string {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(messageID)))
+	return filepath.Join(homeRelativePath(conf.CachePath), hash[:2], hash+cacheFileExt)
+}
+
+// get returns the cached part of the message id and the size of its file
+func (c *ArticleCache) get(messageID string) (*yenc.Part, int64, bool) {
+	if !c.enabled() {
+		return nil, 0, false
+	}
+	file := c.file(messageID)
+	part, fileSize, err := readCachedPart(file, messageID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			Log.Debug("Invalid cache file \"%v\": %v", file, err)
+			c.remove(file)
+		}
+		c.misses++
+		return nil, 0, false
+	}
+	c.hits++
+	// the modification time is the time of the last use
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	return part, fileSize, true
+}
+
+func readCachedPart(file string, messageID string) (*yenc.Part, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, 0, err
+	}
+	var meta cachedPart
+	if err = json.Unmarshal(line, &meta); err != nil {
+		return nil, 0, err
+	}
+	if meta.MessageID != messageID {
+		return nil, 0, fmt.Errorf("the file contains the article <%v>", meta.MessageID)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(body)) != meta.End-meta.Begin+1 {
+		return nil, 0, fmt.Errorf("the part has %d instead of %d bytes", len(body), meta.End-meta.Begin+1)
+	}
+	return &yenc.Part{Number: meta.Number, Size: meta.Size, Begin: meta.Begin, End: meta.End, Name: meta.Name, Body: body}, meta.FileSize, nil
+}
+
+// put adds the part of the message id to the cache
+func (c *ArticleCache) put(messageID string, part *yenc.Part, fileSize int64) {
+	if !c.enabled() {
+		return
+	}
+	meta, err := json.Marshal(cachedPart{
+		MessageID: messageID,
+		Name:      part.Name,
+		Number:    part.Number,
+		Size:      part.Size,
+		Begin:     part.Begin,
+		End:       part.End,
+		FileSize:  fileSize,
+	})
+	if err != nil {
+		return
+	}
+	file := c.file(messageID)
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		Log.Debug("Unable to create the cache directory: %v", err)
+		return
+	}
+	// the part is written to a temporary file first, so other processes never read incomplete parts
+	content := append(append(meta, '\n'), part.Body...)
+	temp, err := os.CreateTemp(filepath.Dir(file), "*.tmp")
+	if err == nil {
+		_, err = temp.Write(content)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(temp.Name(), file)
+		}
+		if err != nil {
+			os.Remove(temp.Name())
+		}
+	}
+	if err != nil {
+		Log.Debug("Unable to write the cache file \"%v\": %v", file, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scan()
+	c.size += int64(len(content))
+	c.trim()
+}
+
+// limitSize deletes the least recently used parts if the cache exceeds its size limit
+func (c *ArticleCache) limitSize() {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scan()
+	c.trim()
+}
+
+// trim evicts parts if the cache exceeds its size limit, c.mu must be held
+func (c *ArticleCache) trim() {
+	c.limit = int64(conf.CacheSize)
+	if c.limit > 0 && c.size > c.limit {
+		c.evict()
+	}
+}
+
+// scan determines the size of the cache once, c.mu must be held
+func (c *ArticleCache) scan() {
+	if c.size >= 0 && c.path == conf.CachePath {
+		return
+	}
+	c.path = conf.CachePath
+	c.size = 0
+	for _, file := range c.files() {
+		c.size += file.size
+	}
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files returns the files of the cache, c.mu must be held
+func (c *ArticleCache) files() []cacheFile {
+	var files []cacheFile
+	filepath.WalkDir(homeRelativePath(conf.CachePath), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != cacheFileExt {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, cacheFile{path, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
+
+// evict deletes the least recently used parts until the cache is below 90% of its limit, c.mu must be held
+// the size is determined again as the cache may be shared with other processes
+func (c *ArticleCache) evict() {
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	c.size = 0
+	for _, file := range files {
+		c.size += file.size
+	}
+	var deleted int
+	target := c.limit / 10 * 9
+	for _, file := range files {
+		if c.size <= target {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			c.size -= file.size
+			deleted++
+		}
+	}
+	Log.Debug("Deleted %d parts from the article cache (%v left)", deleted, formatBytes(c.size))
+}
+
+// remove deletes the cache file, c.mu must be held
+func (c *ArticleCache) remove(file string) {
+	if info, err := os.Stat(file); err == nil && os.Remove(file) == nil && c.size >= 0 {
+		c.size -= info.Size()
+	}
+}
+
+// stats returns the number of parts loaded from the cache and the number of parts not found in the cache
+// and resets the counters
+func (c *ArticleCache) stats() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hits, misses := c.hits, c.misses
+	c.hits, c.misses = 0, 0
+	return hits, misses
+}
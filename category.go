@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// download category with its own destination path and post-processing settings
+// settings that are not set are taken from the configuration
+type Category struct {
+	DestPath   string
+	Repair     *bool
+	DeletePar2 *bool
+	Unrar      *bool
+	DeleteRar  *bool
+	Script     string // run after the download (successful or not)
+	TitleMatch string // regular expression the category is selected by if the title matches
+}
+
+func categoryNames() []string {
+	var names []string
+	for name := range conf.Categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectCategory returns the name of the category of the download and where it was selected
+// precedence: argument, NXGLNK or queued download, title rules, environment variable, configuration file
+func selectCategory() (string, string) {
+	switch source := configSources["Category"]; source {
+	case "flag", "NXGLNK", "queue":
+		return conf.Category, source
+	}
+	if conf.Title != "" {
+		for _, name := range categoryNames() {
+			if pattern := conf.Categories[name].TitleMatch; pattern != "" {
+				if exp, err := regexp.Compile(pattern); err == nil && exp.MatchString(conf.Title) {
+					return name, "title rule"
+				}
+			}
+		}
+	}
+	return conf.Category, configSources["Category"]
+}
+
+// applyCategory applies the settings of the category of the download
+// the settings of the category have precedence over everything but the arguments
+func applyCategory() error {
+	name, source := selectCategory()
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil
+	}
+	category, ok := conf.Categories[name]
+	if !ok {
+		if source == "NXGLNK" {
+			// NXGLNKs may come from anywhere, so the download continues with the default settings
+			Log.Warn("Category \"%v\" of the NXGLNK is not configured", name)
+			return nil
+		}
+		return fmt.Errorf("category \"%v\" not found (available categories: %v)", name, strings.Join(categoryNames(), ", "))
+	}
+	conf.Category = name
+	configSources["Category"] = source
+	Log.Debug("Using category \"%v\" (selected by %v)", name, source)
+
+	settings := map[string]interface{}{
+		"DestPath":   category.DestPath,
+		"Repair":     category.Repair,
+		"DeletePar2": category.DeletePar2,
+		"Unrar":      category.Unrar,
+		"DeleteRar":  category.DeleteRar,
+	}
+	for key, value := range settings {
+		if configSources[key] == "flag" {
+			continue
+		}
+		field := reflect.ValueOf(&conf).Elem().FieldByName(key)
+		switch value := value.(type) {
+		case string:
+			if value == "" {
+				continue
+			}
+			field.SetString(homeRelativePath(value))
+		case *bool:
+			if value == nil {
+				continue
+			}
+			field.SetBool(*value)
+		}
+		configSources[key] = "category " + name
+	}
+	return nil
+}
+
+// runCategoryScript runs the script of the category after the download
+// the result of the download is passed in environment variables
+func runCategoryScript(success bool) {
+	category, ok := conf.Categories[conf.Category]
+	if !ok || category.Script == "" {
+		return
+	}
+	result := "failed"
+	if success {
+		result = "completed"
+	}
+	script := homeRelativePath(category.Script)
+	Log.Info("Running script \"%v\"", script)
+	cmd := exec.Command(script)
+	cmd.Dir = conf.DestPath
+	if _, err := os.Stat(cmd.Dir); err != nil {
+		cmd.Dir = ""
+	}
+	cmd.Env = append(os.Environ(),
+		envPrefix+"DOWNLOAD_RESULT="+result,
+		envPrefix+"DOWNLOAD_CATEGORY="+conf.Category,
+		envPrefix+"DOWNLOAD_TITLE="+conf.Title,
+		envPrefix+"DOWNLOAD_HEADER="+conf.Header,
+		envPrefix+"DOWNLOAD_DEST="+conf.DestPath,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		Log.Warn("Script \"%v\" failed: %v", filepath.Base(script), err)
+	}
+}
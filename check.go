@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// checkArticles checks with the STAT command if all articles of the header are available
+// without downloading them
+func checkArticles() {
+
+	var (
+		articles  = make(chan Article)
+		available = map[string]*atomic.Int64{"data": {}, "par2": {}}
+		failed    atomic.Int64
+		wg        sync.WaitGroup
+		bar       *progressbar.ProgressBar
+	)
+
+	if conf.Verbose > 0 {
+		bar = progressbar.NewOptions(totalParts["data"]+totalParts["par2"],
+			progressbar.OptionSetDescription("INFO:    Checking articles  "),
+			progressbar.OptionSetRenderBlankState(true),
+			progressbar.OptionShowCount(),
+			progressbar.OptionOnCompletion(newline),
+			progressbar.OptionSetWriter(barWriter()),
+		)
+	}
+
+	connNumber := 0
+	for _, server := range servers {
+		for i := 1; i <= server.Connections; i++ {
+			connNumber++
+			wg.Add(1)
+			go func(server *Server, connNumber int) {
+				defer wg.Done()
+				var conn *safeConn
+				defer func() {
+					if conn != nil {
+						conn.Close()
+					}
+				}()
+				for article := range articles {
+					for {
+						if conf.Test == "" && conn == nil {
+							var connErr error
+							if conn, connErr = ConnectNNTP(server); connErr != nil {
+								Log.Debug("Connection %d error: %v", connNumber, connErr)
+								conn = nil
+								article.retries++
+								time.Sleep(time.Duration(conf.ConnWaitTime))
+							}
+						}
+						if conn != nil || conf.Test != "" {
+							found, err := stat(conn, article.id)
+							if err == nil {
+								if found {
+									available[article.partType].Add(1)
+								} else {
+									Log.Debug("Article with message id <%v> not found", article.id)
+								}
+								break
+							}
+							Log.Debug("Connection %d error checking article with message id <%v>: %v", connNumber, article.id, err)
+							if !isProtocolError(err) && conn != nil {
+								conn.Close()
+								conn = nil
+							}
+							article.retries++
+						}
+						if article.retries > conf.Retries {
+							Log.Warn("Unable to check article with message id <%v>", article.id)
+							failed.Add(1)
+							break
+						}
+					}
+					if bar != nil {
+						bar.Add(1)
+					}
+				}
+			}(server, connNumber)
+		}
+	}
+
+	for _, partType := range []string{"data", "par2"} {
+		for i := 1; i <= totalParts[partType]; i++ {
+			articles <- Article{id: messageID(partType, i), partType: partType, index: i}
+		}
+	}
+	close(articles)
+	wg.Wait()
+	if bar != nil {
+		bar.Finish()
+	}
+
+	missingData := int64(totalParts["data"]) - available["data"].Load()
+	Log.Info("Data articles available: %d of %d", available["data"].Load(), totalParts["data"])
+	Log.Info("Par2 articles available: %d of %d", available["par2"].Load(), totalParts["par2"])
+	switch {
+	case failed.Load() > 0:
+		Log.Error("%d articles could not be checked", failed.Load())
+		exit(1)
+	case missingData == 0:
+		Log.Succ("All data articles are available")
+	case missingData <= available["par2"].Load():
+		Log.Warn("%d data articles are missing, the download needs to be repaired", missingData)
+	default:
+		Log.Error("%d data articles are missing, the download cannot be repaired", missingData)
+		exit(1)
+	}
+	exit(0)
+}
+
+// stat checks if the article with the message id is available
+func stat(conn *safeConn, messageId string) (bool, error) {
+	if conf.Test != "" {
+		_, err := readFromFile(messageId)
+		return err == nil, nil
+	}
+	return conn.Stat(fmt.Sprintf("<%v>", messageId))
+}
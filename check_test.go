@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatCommandLine(t *testing.T) {
+	withConf(t, func() {
+		conf.ReadTimeout = Duration(time.Second)
+		conf.Test = ""
+	})
+	conn, fake := newFakeConn(t, &Server{Host: "fake"}, "200 welcome\r\n", func(command string, w io.Writer) {
+		if command == "STAT <part1@test>" {
+			io.WriteString(w, "223 0 <part1@test>\r\n")
+		} else {
+			io.WriteString(w, "501 syntax error\r\n")
+		}
+	})
+	if err := conn.start(); err != nil {
+		t.Fatal(err)
+	}
+	found, err := stat(conn, "part1@test")
+	if err != nil || !found {
+		t.Errorf("stat() = %v, %v, want true, nil", found, err)
+	}
+	if got, want := strings.Join(fake.list(), "|"), "STAT <part1@test>"; got != want {
+		t.Errorf("command = %q, want %q", got, want)
+	}
+}
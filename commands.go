@@ -0,0 +1,235 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// commands of the command line interface
+type Commands struct {
+	Download   *DownloadCmd `arg:"subcommand:download" help:"Download a NXG header (default if no command is provided)"`
+	Handle     *DownloadCmd `arg:"subcommand:handle" help:"Handle a NXGLNK without terminal: add it to the queue of a running serve command or download it in the background with desktop notifications"`
+	Batch      *BatchCmd    `arg:"subcommand:batch" help:"Download several NXGLNKs or headers one after another with the same connections"`
+	Check      *DownloadCmd `arg:"subcommand:check" help:"Check if all articles of a NXG header are available on the usenet servers"`
+	Register   *RegisterCmd `arg:"subcommand:register" help:"Register the NXGLNK scheme"`
+	Unregister *struct{}    `arg:"subcommand:unregister" help:"Unregister the NXGLNK scheme"`
+	Config     *ConfigCmd   `arg:"subcommand:config" help:"Create, show or check the configuration"`
+	Serve      *ServeCmd    `arg:"subcommand:serve" help:"Process the download queue"`
+	Watch      *WatchCmd    `arg:"subcommand:watch" help:"Watch folders for dropped .nxglnk and .txt files and add their downloads to the download queue"`
+	Queue      *QueueCmd    `arg:"subcommand:queue" help:"Add, list or remove downloads of the download queue"`
+	Link       *LinkCmd     `arg:"subcommand:link" help:"Create a NXGLNK from the --header, --title and --password arguments"`
+	Repair     *DirCmd      `arg:"subcommand:repair" help:"Repair the files in a directory using its par2 files"`
+	Extract    *DirCmd      `arg:"subcommand:extract" help:"Extract the rar files in a directory"`
+}
+
+type DownloadCmd struct {
+	NxgLnk string `arg:"positional" help:"Fully qualified NXGLNK URI (nxglnk://?h=header&t=title&p=password)"`
+}
+
+type BatchCmd struct {
+	Items []string `arg:"positional" help:"NXGLNKs or headers to download (\"-\" reads them from stdin)" placeholder:"NXGLNK|HEADER"`
+	File  string   `arg:"--file" help:"Text file with one NXGLNK or header per line, optionally followed by title and password separated by tabs (\"-\" for stdin)" placeholder:"PATH"`
+}
+
+type RegisterCmd struct {
+	Status   bool `arg:"--status" help:"Show the status of the registration instead of registering"`
+	Headless bool `arg:"--headless" help:"Handle the NXGLNKs without terminal (see the handle command)"`
+}
+
+type ConfigCmd struct {
+	Init  *ConfigInitCmd `arg:"subcommand:init" help:"Create the configuration file with the default settings"`
+	Show  *struct{}      `arg:"subcommand:show" help:"Show the effective configuration and the source of each setting"`
+	Check *struct{}      `arg:"subcommand:check" help:"Check the configuration"`
+}
+
+type ConfigInitCmd struct {
+	Force bool `arg:"--force" help:"Overwrite an existing configuration file"`
+}
+
+type ServeCmd struct {
+	Interval Duration `arg:"--interval" default:"5s" help:"Time to wait before checking the download queue again if it is empty" placeholder:"DURATION"`
+}
+
+type WatchCmd struct {
+	Dirs []string `arg:"positional" help:"Folders to watch (default: WatchFolders of the configuration)" placeholder:"DIR"`
+}
+
+type QueueCmd struct {
+	Add    *DownloadCmd    `arg:"subcommand:add" help:"Add a NXGLNK (or the --header, --title and --password arguments) to the download queue"`
+	List   *struct{}       `arg:"subcommand:list" help:"List the downloads of the download queue"`
+	Remove *QueueRemoveCmd `arg:"subcommand:remove" help:"Remove downloads from the download queue"`
+}
+
+type QueueRemoveCmd struct {
+	IDs []int `arg:"positional,required" help:"IDs of the downloads to remove" placeholder:"ID"`
+}
+
+type LinkCmd struct {
+	Date   string   `arg:"--date" help:"Date the files were posted (YYYY-MM-DD, DD.MM.YYYY or Unix timestamp)" placeholder:"DATE"`
+	Groups []string `arg:"--group,separate" help:"Newsgroup the files were posted to (can be repeated)" placeholder:"NEWSGROUP"`
+	NoQR   bool     `arg:"--no-qr" help:"Do not show the QR code of the NXGLNK"`
+}
+
+type DirCmd struct {
+	Dir  string `arg:"positional,required" help:"Directory with the downloaded files" placeholder:"DIR"`
+	Dest string `arg:"positional" help:"Directory to move the files to afterwards (extract: also the directory to extract to)" placeholder:"DEST"`
+}
+
+var (
+	commands Commands
+
+	// name of the command to run (e.g. "download" or "config show")
+	command string
+)
+
+// withDefaultCommand inserts the "download" command if no command is provided,
+// so the program can still be called with a NXGLNK or the --header argument only
+func withDefaultCommand(args []string) []string {
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "--help", "--version",
+			"download", "handle", "batch", "check", "register", "unregister", "config", "serve", "watch", "queue", "link", "repair", "extract":
+			return args
+		case "--register":
+			// former flag to register the protocol
+			return append([]string{"register"}, args[1:]...)
+		}
+	}
+	return append([]string{"download"}, args...)
+}
+
+// nxgLnk returns the NXGLNK passed to the command (if any)
+func (c Commands) nxgLnk() string {
+	switch {
+	case c.Download != nil:
+		return c.Download.NxgLnk
+	case c.Handle != nil:
+		return c.Handle.NxgLnk
+	case c.Check != nil:
+		return c.Check.NxgLnk
+	case c.Queue != nil && c.Queue.Add != nil:
+		return c.Queue.Add.NxgLnk
+	}
+	return ""
+}
+
+// runCommand runs the command passed as argument
+func runCommand() {
+	switch {
+	case commands.Register != nil:
+		runRegisterCommand()
+	case commands.Unregister != nil:
+		runUnregisterCommand()
+	case commands.Config != nil:
+		runConfigCommand()
+	case commands.Serve != nil:
+		serve()
+	case commands.Watch != nil:
+		runWatchCommand()
+	case commands.Queue != nil:
+		runQueueCommand()
+	case commands.Link != nil:
+		runLinkCommand()
+	case commands.Repair != nil:
+		runRepairCommand()
+	case commands.Extract != nil:
+		runExtractCommand()
+	case commands.Handle != nil:
+		runHandleCommand()
+	case commands.Batch != nil:
+		runBatchCommand()
+	case commands.Check != nil:
+		checkArguments()
+		checkArticles()
+	default:
+		checkArguments()
+		download()
+	}
+}
+
+// runHandleCommand handles a NXGLNK without terminal
+func runHandleCommand() {
+	conf.Notify = true
+	conf.Headless = true
+	if serveRunning() {
+		item, err := queueDownload()
+		if err != nil {
+			notify("Download failed", err.Error())
+			Log.Error("Unable to add the download to the queue: %v", err)
+			os.Exit(exitCodeOf(err))
+		}
+		notify("Download added to the queue", item.name())
+		Log.Info("Download %d added to the queue", item.ID)
+		os.Exit(0)
+	}
+	// the download is run by this process
+	command = "download"
+	checkArguments()
+	download()
+}
+
+// runRepairCommand repairs the files of an existing directory
+func runRepairCommand() {
+	setStandalonePaths(commands.Repair, "")
+	if err := checkExecutable(conf.Par2Exe); err != nil {
+		Log.Error("Configuration: Par2Exe: %v", err)
+		os.Exit(exitInvalidInput)
+	}
+	if err := par2(); err != nil {
+		Log.Error("Error while repairing: %v", err)
+		os.Exit(exitRepairFailed)
+	}
+	if commands.Repair.Dest != "" {
+		if err := moveFiles(); err != nil {
+			Log.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+// runExtractCommand extracts the rar files of an existing directory
+func runExtractCommand() {
+	setStandalonePaths(commands.Extract, commands.Extract.Dir)
+	if err := checkExecutable(conf.RarExe); err != nil {
+		Log.Error("Configuration: RarExe: %v", err)
+		os.Exit(exitInvalidInput)
+	}
+	if err := unrar(); err != nil {
+		Log.Error("Error while extracting rar archive: %v", err)
+		os.Exit(exitExtractFailed)
+	}
+	if commands.Extract.Dest != "" {
+		if err := moveFiles(); err != nil {
+			Log.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+// setStandalonePaths uses the directory of the command as temporary path and
+// its destination (or defaultDest) as destination path of the pipeline stages
+func setStandalonePaths(cmd *DirCmd, defaultDest string) {
+	conf.TempPath = workRelativePath(cmd.Dir)
+	conf.DestPath = workRelativePath(defaultDest)
+	if cmd.Dest != "" {
+		conf.DestPath = workRelativePath(cmd.Dest)
+		if err := os.MkdirAll(conf.DestPath, os.ModePerm); err != nil {
+			Log.Error("Unable to create destination path \"%v\": %v", conf.DestPath, err)
+			os.Exit(1)
+		}
+	}
+	if info, err := os.Stat(conf.TempPath); err != nil || !info.IsDir() {
+		Log.Error("\"%v\" is not a directory", conf.TempPath)
+		os.Exit(exitInvalidInput)
+	}
+}
+
+// workRelativePath treats relative paths as relative to the working directory the program was started in
+func workRelativePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workPath, path)
+}
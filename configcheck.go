@@ -0,0 +1,449 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// configuration key with the struct field holding its value
+type configField struct {
+	key   string
+	flags []string
+	value reflect.Value
+}
+
+// problem found in the configuration
+type configProblem struct {
+	key     string
+	message string
+	warning bool
+}
+
+// arguments that are not part of the configuration
+var nonConfigKeys = map[string]bool{
+	"NxgLnk":    true,
+	"StorePass": true,
+}
+
+// source of each configuration value ("default", "file", "profile NAME", "environment variable NAME", "NXGLNK" or "flag")
+var configSources = make(map[string]string)
+
+// configFields returns the configuration keys of the struct in the order of their definition
+func configFields(v reflect.Value) []configField {
+	var fields []configField
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(v.Field(i))...)
+			continue
+		}
+		if !field.IsExported() || nonConfigKeys[field.Name] {
+			continue
+		}
+		flag := ""
+		if tag := strings.Split(field.Tag.Get("arg"), ","); strings.HasPrefix(tag[0], "--") {
+			flag = tag[0]
+		}
+		configField := configField{key: field.Name, value: v.Field(i)}
+		if flag != "" {
+			configField.flags = append(configField.flags, flag)
+		}
+		fields = append(fields, configField)
+	}
+	return fields
+}
+
+// recordConfigSources records which configuration values were read from the configuration file
+func recordConfigSources() {
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		if source, ok := environmentSource(field.key); ok {
+			configSources[field.key] = source
+		} else if viper.InConfig(field.key) && configFileUsed {
+			configSources[field.key] = "file"
+		} else {
+			configSources[field.key] = "default"
+		}
+	}
+}
+
+// recordArgumentSources records which configuration values were passed as arguments
+func recordArgumentSources(args []string) {
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		for _, flag := range field.flags {
+			for _, arg := range args {
+				if arg == flag || strings.HasPrefix(arg, flag+"=") {
+					configSources[field.key] = "flag"
+				}
+			}
+		}
+	}
+}
+
+// validateConfig checks the configuration and returns all problems found
+func validateConfig() (problems []configProblem) {
+
+	problemf := func(key string, format string, vars ...interface{}) {
+		problems = append(problems, configProblem{key: key, message: fmt.Sprintf(format, vars...)})
+	}
+	warnf := func(key string, format string, vars ...interface{}) {
+		problems = append(problems, configProblem{key: key, message: fmt.Sprintf(format, vars...), warning: true})
+	}
+
+	// unknown keys in the configuration file
+	knownKeys := make(map[string]bool)
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		knownKeys[strings.ToLower(field.key)] = true
+	}
+	knownServerKeys := make(map[string]bool)
+	for _, field := range configFields(reflect.ValueOf(&Server{}).Elem()) {
+		knownServerKeys[strings.ToLower(field.key)] = true
+	}
+	for _, key := range viper.AllKeys() {
+		if viper.InConfig(key) && !knownKeys[strings.Split(key, ".")[0]] && !isProfileKey(key) {
+			warnf(key, "unknown setting")
+		}
+	}
+	if list, ok := viper.Get("Servers").([]interface{}); ok {
+		for i, item := range list {
+			if server, ok := item.(map[string]interface{}); ok {
+				for key := range server {
+					if !knownServerKeys[strings.ToLower(key)] {
+						warnf(fmt.Sprintf("Servers[%d].%v", i+1, key), "unknown setting")
+					}
+				}
+			}
+		}
+	}
+
+	// profiles
+	for name, item := range viper.GetStringMap("Profiles") {
+		profile, ok := item.(map[string]interface{})
+		if !ok {
+			problemf("Profiles."+name, "profile is empty or not a list of settings")
+			continue
+		}
+		for key := range profile {
+			if key == "profile" || key == "profiles" {
+				warnf(fmt.Sprintf("Profiles.%v.%v", name, key), "profiles cannot be selected or defined within a profile")
+			} else if key != "inherit" && !knownKeys[key] {
+				warnf(fmt.Sprintf("Profiles.%v.%v", name, key), "unknown setting")
+			}
+		}
+		if _, err := profileChain(name); err != nil {
+			problemf("Profiles."+name, "%v", err)
+		}
+	}
+
+	// usenet servers
+	serverList := make(map[string]*Server)
+	if conf.Host != "" {
+		serverList[""] = &conf.Server
+	}
+	for i := range conf.Servers {
+		serverList[fmt.Sprintf("Servers[%d].", i+1)] = &conf.Servers[i]
+	}
+	if len(serverList) == 0 {
+		problemf("Host", "no usenet server configured")
+	}
+	for prefix, server := range serverList {
+		if server.Host == "" {
+			problemf(prefix+"Host", "no host name provided")
+		}
+		if server.Port < 1 || server.Port > 65535 {
+			problemf(prefix+"Port", "%d is not a valid port number (1-65535)", server.Port)
+		}
+		if server.Connections < 1 {
+			problemf(prefix+"Connections", "must be at least 1 but is %d", server.Connections)
+		}
+		if server.NntpPass != "" && server.NntpPassRef != "" {
+			problemf(prefix+"NntpPassRef", "both NntpPass and NntpPassRef are set")
+		}
+		if server.SSL {
+			if _, err := newTLSConfig(server); err != nil {
+				problemf(prefix+"TLS", "%v", err)
+			}
+		}
+		if _, err := proxyURL(server); err != nil {
+			problemf(prefix+"Proxy", "%v", err)
+		}
+	}
+
+	// categories
+	knownCategoryKeys := make(map[string]bool)
+	for _, field := range configFields(reflect.ValueOf(&Category{}).Elem()) {
+		knownCategoryKeys[strings.ToLower(field.key)] = true
+	}
+	for name, item := range viper.GetStringMap("Categories") {
+		if settings, ok := item.(map[string]interface{}); ok {
+			for key := range settings {
+				if !knownCategoryKeys[key] {
+					warnf(fmt.Sprintf("Categories.%v.%v", name, key), "unknown setting")
+				}
+			}
+		}
+	}
+	for _, name := range categoryNames() {
+		category := conf.Categories[name]
+		if category.TitleMatch != "" {
+			if _, err := regexp.Compile(category.TitleMatch); err != nil {
+				problemf("Categories."+name+".TitleMatch", "invalid regular expression: %v", err)
+			}
+		}
+		if category.Script != "" {
+			if err := checkExecutable(homeRelativePath(category.Script)); err != nil {
+				problemf("Categories."+name+".Script", "%v", err)
+			}
+		}
+	}
+	if source := configSources["Category"]; conf.Category != "" && source != "flag" && source != "NXGLNK" {
+		if _, ok := conf.Categories[strings.ToLower(conf.Category)]; !ok {
+			problemf("Category", "category \"%v\" not found (available categories: %v)", conf.Category, strings.Join(categoryNames(), ", "))
+		}
+	}
+
+	// download settings
+	if conf.MinFreeSpace < 0 {
+		problemf("MinFreeSpace", "must not be negative but is %v", conf.MinFreeSpace)
+	}
+	if conf.Output != "" && !slices.Contains(outputFormats, conf.Output) {
+		problemf("Output", "\"%v\" is not valid (%v)", conf.Output, strings.Join(outputFormats, ", "))
+	}
+	if conf.CacheSize < 0 {
+		problemf("CacheSize", "must not be negative but is %v", conf.CacheSize)
+	}
+	if conf.SpeedLimit < 0 {
+		problemf("SpeedLimit", "must not be negative but is %v", conf.SpeedLimit)
+	}
+	if conf.ArticleOrder != "" && !slices.Contains(articleOrders, conf.ArticleOrder) {
+		problemf("ArticleOrder", "\"%v\" is not valid (%v)", conf.ArticleOrder, strings.Join(articleOrders, ", "))
+	}
+	for _, pattern := range conf.PriorityFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			problemf("PriorityFiles", "invalid pattern \"%v\"", pattern)
+		}
+	}
+	if conf.ConflictPolicy != "" && !slices.Contains(conflictPolicies, conf.ConflictPolicy) {
+		problemf("ConflictPolicy", "\"%v\" is not valid (%v)", conf.ConflictPolicy, strings.Join(conflictPolicies, ", "))
+	}
+	if conf.Priority != "" {
+		if _, err := parsePriority(conf.Priority); err != nil {
+			problemf("Priority", "%v", err)
+		}
+	}
+	if conf.Subfolder != "" {
+		if err := checkSubfolder(conf.Subfolder); err != nil {
+			problemf("Subfolder", "%v", err)
+		}
+	}
+
+	// numeric settings
+	for key, value := range map[string]int{
+		"ConnRetries": conf.ConnRetries,
+		"Retries":     conf.Retries,
+	} {
+		if value < 0 {
+			problemf(key, "must not be negative but is %d", value)
+		}
+	}
+	for key, value := range map[string]Duration{
+		"ConnWaitTime":    conf.ConnWaitTime,
+		"DialTimeout":     conf.DialTimeout,
+		"AuthTimeout":     conf.AuthTimeout,
+		"ReadTimeout":     conf.ReadTimeout,
+		"StallTime":       conf.StallTime,
+		"SuccessWaitTime": conf.SuccessWaitTime,
+		"ErrorWaitTime":   conf.ErrorWaitTime,
+	} {
+		if value < 0 {
+			problemf(key, "must not be negative but is %v", value)
+		}
+	}
+	if conf.Verbose < 0 || conf.Verbose > 3 {
+		problemf("Verbose", "must be between 0 and 3 but is %d", conf.Verbose)
+	}
+
+	// executables
+	if conf.Repair {
+		if err := checkExecutable(conf.Par2Exe); err != nil {
+			problemf("Par2Exe", "%v (required for repair)", err)
+		}
+	}
+	if conf.Unrar {
+		if err := checkExecutable(conf.RarExe); err != nil {
+			problemf("RarExe", "%v (required for unrar)", err)
+		}
+	}
+
+	// paths
+	if conf.DestPath == "" {
+		problemf("DestPath", "no destination path provided")
+	}
+	for key, path := range map[string]string{
+		"TempPath":    conf.TempPath,
+		"DestPath":    conf.DestPath,
+		"LogFilePath": conf.LogFilePath,
+	} {
+		if path != "" {
+			if err := checkWritable(homeRelativePath(path)); err != nil {
+				problemf(key, "%v", err)
+			}
+		}
+	}
+	if conf.TempPath != "" && homeRelativePath(conf.TempPath) == homeRelativePath(conf.DestPath) {
+		problemf("TempPath", "temporary path and destination path must be different")
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].key < problems[j].key
+	})
+	return problems
+}
+
+// checkExecutable checks that the path (or the name in the PATH) is an executable file
+func checkExecutable(path string) error {
+	if path == "" {
+		return fmt.Errorf("no executable provided")
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return fmt.Errorf("\"%v\" is not an executable file", path)
+	}
+	return nil
+}
+
+// checkWritable checks that the path (or, if it does not exist yet, its nearest existing parent) is a writable directory
+func checkWritable(path string) error {
+	dir := path
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("\"%v\" is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("\"%v\" cannot be created", path)
+		}
+		dir = parent
+	}
+	testFile, err := os.CreateTemp(dir, ".nxg-loader-*")
+	if err != nil {
+		return fmt.Errorf("\"%v\" is not writable", dir)
+	}
+	testFile.Close()
+	os.Remove(testFile.Name())
+	return nil
+}
+
+// checkConfig logs all problems found in the configuration and returns false if there are errors
+func checkConfig() bool {
+	errors := 0
+	for _, problem := range validateConfig() {
+		if problem.warning {
+			Log.Warn("Configuration: %v: %v", problem.key, problem.message)
+		} else {
+			Log.Error("Configuration: %v: %v", problem.key, problem.message)
+			errors++
+		}
+	}
+	if errors > 0 {
+		Log.Error("The configuration contains %d error(s), please check \"%v\"", errors, filepath.Join(confFilePath, configFileName))
+		return false
+	}
+	return true
+}
+
+// showConfig prints the effective configuration with the source of each value
+func showConfig() {
+	if configFileUsed {
+		fmt.Printf("# Configuration file: %v\n", filepath.Join(confFilePath, configFileName))
+	} else {
+		fmt.Printf("# No configuration file (headless mode)\n")
+	}
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		source := configSources[field.key]
+		if source == "" {
+			source = "default"
+		}
+		if field.key == "Profiles" {
+			fmt.Printf("%-40s # %v\n", fmt.Sprintf("Profiles: [%v]", strings.Join(profileNames(), ", ")), source)
+			continue
+		}
+		if field.key == "Categories" {
+			fmt.Printf("%-40s # %v\n", fmt.Sprintf("Categories: [%v]", strings.Join(categoryNames(), ", ")), source)
+			continue
+		}
+		if field.key == "Servers" {
+			fmt.Printf("%-40s # %v\n", "Servers:", source)
+			for i := range conf.Servers {
+				for j, serverField := range configFields(reflect.ValueOf(&conf.Servers[i]).Elem()) {
+					prefix := "    "
+					if j == 0 {
+						prefix = "  - "
+					}
+					fmt.Printf("%v%v: %v\n", prefix, serverField.key, formatConfigValue(serverField.key, serverField.value))
+				}
+			}
+			continue
+		}
+		fmt.Printf("%-40s # %v\n", field.key+": "+formatConfigValue(field.key, field.value), source)
+	}
+}
+
+// formatConfigValue formats the value for the output with secrets redacted
+func formatConfigValue(key string, value reflect.Value) string {
+	switch key {
+	case "NntpPass", "Password":
+		if value.String() != "" {
+			return `"********"`
+		}
+	case "Proxy":
+		if proxyURL, err := url.Parse(value.String()); err == nil && proxyURL.User != nil {
+			// the mask is added after the URL is built, otherwise it would be escaped
+			userInfo := url.User(proxyURL.User.Username()).String()
+			if _, ok := proxyURL.User.Password(); ok {
+				userInfo += ":********"
+			}
+			proxyURL.User = nil
+			return fmt.Sprintf("%q", strings.Replace(proxyURL.String(), "://", "://"+userInfo+"@", 1))
+		}
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", value.String())
+	case reflect.Slice:
+		var items []string
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, formatConfigValue(key, value.Index(i)))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", value.Interface())
+	}
+}
+
+// isProfileKey returns true if the key was merged into the configuration from a profile
+func isProfileKey(key string) bool {
+	for _, item := range viper.GetStringMap("Profiles") {
+		if profile, ok := item.(map[string]interface{}); ok {
+			if _, ok := profile[strings.Split(key, ".")[0]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -11,6 +11,9 @@ import (
 
 var conf Args
 
+// false if no configuration file was found in headless mode
+var configFileUsed = true
+
 func loadConfig() error {
 
 	// Set the file name of the configurations file
@@ -22,25 +25,51 @@ func loadConfig() error {
 	// Set config type to yaml
 	viper.SetConfigType("yaml")
 
+	// Set defaults for settings missing in older configuration files
+	viper.SetDefault("DialTimeout", 30)
+	viper.SetDefault("AuthTimeout", 30)
+	viper.SetDefault("ReadTimeout", 60)
+	viper.SetDefault("StallTime", 10)
+
 	if err := viper.ReadInConfig(); err != nil {
-		if strings.Contains(err.Error(), "Not Found") {
+		if strings.Contains(err.Error(), "Not Found") && isHeadless() {
+			// use the default configuration without the system specific paths
+			configFileUsed = false
+			viper.ReadConfig(strings.NewReader(defaultConfig()))
+			viper.MergeConfigMap(map[string]interface{}{
+				"Par2Exe":     "par2",
+				"RarExe":      "unrar",
+				"TempPath":    "",
+				"DestPath":    "",
+				"LogFilePath": "",
+				"EndWaitTime": false,
+			})
+		} else if strings.Contains(err.Error(), "Not Found") {
 			fmt.Println("Configuration file not found. Creating configuration file...")
-			defaultConfig := []byte(defaultConfig())
-			if err := os.WriteFile(filepath.Join(confFilePath, configFileName), defaultConfig, 0644); err != nil {
+			if err := writeDefaultConfig(); err != nil {
 				checkForFatalErr(fmt.Errorf("Error creating configuration file: %v", err))
 			} else {
 				Log.Info("Configuration file \"%v\" created.", filepath.Join(confFilePath, configFileName))
 				fmt.Println("Please edit default values!")
-				registerProtocol()
+				runRegisterCommand()
 			}
 		} else {
 			checkForFatalErr(fmt.Errorf("Error reading configuration file: %v", err))
 		}
 	}
 
-	if err := viper.Unmarshal(&conf); err != nil {
-		checkForFatalErr(fmt.Errorf("Unable to decode configuration file structure: %v", err))
+	// Bind the environment variables
+	bindEnvironment()
+
+	if err := decodeConfig(&conf); err != nil {
+		checkForFatalErr(fmt.Errorf("Invalid configuration: %v", err))
 	}
+	recordConfigSources()
 
 	return nil
 }
+
+// writeDefaultConfig writes the configuration file with the default settings
+func writeDefaultConfig() error {
+	return os.WriteFile(filepath.Join(confFilePath, configFileName), []byte(defaultConfig()), 0600)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// byte ranges of a file that were written to disk
+type fileCoverage struct {
+	mu       sync.Mutex
+	name     string
+	partType string
+	size     int64      // size of the file from the yEnc header, 0 if unknown
+	ranges   [][2]int64 // sorted and merged ranges [begin, end)
+}
+
+var (
+	coverageMu sync.Mutex
+	coverages  = make(map[string]*fileCoverage)
+)
+
+// resetCoverage forgets the files of the previous download
+func resetCoverage() {
+	coverageMu.Lock()
+	defer coverageMu.Unlock()
+	coverages = make(map[string]*fileCoverage)
+}
+
+// coverageOf returns the coverage of the file, it is created if it does not exist yet
+func coverageOf(name string) *fileCoverage {
+	coverageMu.Lock()
+	defer coverageMu.Unlock()
+	coverage, ok := coverages[name]
+	if !ok {
+		coverage = &fileCoverage{name: name}
+		coverages[name] = coverage
+	}
+	return coverage
+}
+
+// register sets the part type and the size of the file (if known)
+func (c *fileCoverage) register(partType string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.partType = partType
+	if size > 0 {
+		c.size = size
+	}
+}
+
+// add marks the bytes from begin to end (exclusive) as written
+func (c *fileCoverage) add(begin int64, end int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ranges = append(c.ranges, [2]int64{begin, end})
+	sort.Slice(c.ranges, func(i, j int) bool { return c.ranges[i][0] < c.ranges[j][0] })
+	merged := c.ranges[:1]
+	for _, r := range c.ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			last[1] = max(last[1], r[1])
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	c.ranges = merged
+}
+
+// covers returns true if the bytes from begin to end (exclusive) were written
+func (c *fileCoverage) covers(begin int64, end int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.ranges {
+		if r[0] <= begin && r[1] >= end {
+			return true
+		}
+	}
+	return false
+}
+
+// written returns the number of bytes written
+func (c *fileCoverage) written() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var written int64
+	for _, r := range c.ranges {
+		written += r[1] - r[0]
+	}
+	return written
+}
+
+// missing returns the byte ranges of the file that were not written
+// without the size of the file only the gaps between the written ranges are known
+func (c *fileCoverage) missing() [][2]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var (
+		gaps [][2]int64
+		pos  int64
+	)
+	for _, r := range c.ranges {
+		if r[0] > pos {
+			gaps = append(gaps, [2]int64{pos, r[0]})
+		}
+		pos = r[1]
+	}
+	if c.size > pos {
+		gaps = append(gaps, [2]int64{pos, c.size})
+	}
+	return gaps
+}
+
+// incompleteFiles returns the files of the part type that have missing byte ranges
+func incompleteFiles(partType string) []*fileCoverage {
+	coverageMu.Lock()
+	defer coverageMu.Unlock()
+	var incomplete []*fileCoverage
+	for _, coverage := range coverages {
+		if coverage.partType == partType && len(coverage.missing()) > 0 {
+			incomplete = append(incomplete, coverage)
+		}
+	}
+	sort.Slice(incomplete, func(i, j int) bool { return incomplete[i].name < incomplete[j].name })
+	return incomplete
+}
+
+// deletePar2Files deletes the par2 files of the download from the temporary path
+func deletePar2Files() {
+	coverageMu.Lock()
+	defer coverageMu.Unlock()
+	for name, coverage := range coverages {
+		if coverage.partType != "par2" {
+			continue
+		}
+		Log.Debug("Deleting par2 file \"%v\"", name)
+		if err := os.Remove(filepath.Join(conf.TempPath, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			Log.Warn("Unable to delete the par2 file \"%v\": %v", name, err)
+		}
+	}
+}
+
+// logIncompleteFiles logs the missing bytes of the incomplete files
+func logIncompleteFiles(files []*fileCoverage) {
+	for _, file := range files {
+		var (
+			missing int64
+			ranges  []string
+		)
+		for _, gap := range file.missing() {
+			missing += gap[1] - gap[0]
+			ranges = append(ranges, fmt.Sprintf("%d-%d", gap[0], gap[1]-1))
+		}
+		Log.Info("Incomplete file \"%v\": %v missing (bytes %v)", file.name, formatBytes(missing), strings.Join(ranges, ", "))
+	}
+}
+
+// yencFileSize returns the size of the file from the "=ybegin" line of the article body, 0 if not found
+func yencFileSize(body []byte) int64 {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, []byte("=ybegin ")) {
+			continue
+		}
+		for _, field := range strings.Fields(string(line)) {
+			if value, ok := strings.CutPrefix(field, "size="); ok {
+				size, _ := strconv.ParseInt(value, 10, 64)
+				return size
+			}
+		}
+		return 0
+	}
+	return 0
+}
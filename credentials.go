@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// credentials are referenced in the configuration as "<backend>:<name>"
+//
+//	keyring:NAME    password stored in the OS keyring (Secret Service, macOS Keychain, Windows Credential Manager)
+//	credfile:NAME   password stored in the encrypted credentials file
+//	env:VARIABLE    password read from an environment variable
+//	cmd:COMMAND     first line of the output of a command (e.g. "cmd:pass show usenet/provider")
+
+const (
+	keyringService         = "nxg-loader"
+	credentialsFileName    = "nxg-loader.credentials"
+	masterPasswordEnvVar   = "NXG_MASTER_PASSWORD"
+	credentialsFileVersion = 1
+)
+
+// encrypted credentials file
+type credentialsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+var masterPassword []byte
+
+// resolveCredential returns the password referenced by ref
+func resolveCredential(ref string) (string, error) {
+	backend, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" {
+		return "", fmt.Errorf("invalid credential reference \"%v\" (must be keyring:NAME, credfile:NAME, env:VARIABLE or cmd:COMMAND)", ref)
+	}
+	switch backend {
+	case "keyring":
+		return keyringGet(keyringService, name)
+	case "credfile":
+		credentials, err := readCredentialsFile()
+		if err != nil {
+			return "", err
+		}
+		if password, ok := credentials[name]; ok {
+			return password, nil
+		}
+		return "", fmt.Errorf("no credential \"%v\" found in the credentials file", name)
+	case "env":
+		if password, ok := os.LookupEnv(name); ok {
+			return password, nil
+		}
+		return "", fmt.Errorf("environment variable \"%v\" is not set", name)
+	case "cmd":
+		return credentialCommand(name)
+	default:
+		return "", fmt.Errorf("unknown credential backend \"%v\" (must be keyring, credfile, env or cmd)", backend)
+	}
+}
+
+// storeCredential prompts for a password and stores it in the backend referenced by ref
+func storeCredential(ref string) error {
+	backend, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" || (backend != "keyring" && backend != "credfile") {
+		return fmt.Errorf("passwords can only be stored with a reference like keyring:NAME or credfile:NAME")
+	}
+	password, err := promptPassword(fmt.Sprintf("Password for \"%v\": ", ref))
+	if err != nil {
+		return err
+	}
+	if backend == "keyring" {
+		return keyringSet(keyringService, name, string(password))
+	}
+	credentials, err := readCredentialsFile()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		credentials = make(map[string]string)
+	}
+	credentials[name] = string(password)
+	return writeCredentialsFile(credentials)
+}
+
+func credentialCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	password, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimRight(password, "\r"), nil
+}
+
+func credentialsFilePath() string {
+	return filepath.Join(confFilePath, credentialsFileName)
+}
+
+func readCredentialsFile() (map[string]string, error) {
+	var (
+		file        credentialsFile
+		credentials map[string]string
+	)
+	content, err := os.ReadFile(credentialsFilePath())
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("credentials file \"%v\" is corrupt: %v", credentialsFilePath(), err)
+	}
+	if file.Version != credentialsFileVersion {
+		return nil, fmt.Errorf("unsupported version %v of credentials file \"%v\"", file.Version, credentialsFilePath())
+	}
+	gcm, err := credentialsCipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt credentials file (wrong master password?)")
+	}
+	if err = json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, fmt.Errorf("credentials file \"%v\" is corrupt: %v", credentialsFilePath(), err)
+	}
+	return credentials, nil
+}
+
+func writeCredentialsFile(credentials map[string]string) error {
+	file := credentialsFile{
+		Version: credentialsFileVersion,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := credentialsCipher(file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plaintext, nil)
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(credentialsFilePath(), content, 0600)
+}
+
+// credentialsCipher derives the key for the credentials file from the master password
+func credentialsCipher(salt []byte) (cipher.AEAD, error) {
+	if masterPassword == nil {
+		if password, ok := os.LookupEnv(masterPasswordEnvVar); ok {
+			masterPassword = []byte(password)
+		} else {
+			var err error
+			if masterPassword, err = promptPassword("Master password for the credentials file: "); err != nil {
+				return nil, fmt.Errorf("no master password for the credentials file: %v", err)
+			}
+		}
+	}
+	key, err := scrypt.Key(masterPassword, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// promptPassword reads a password from the terminal
+// or the first line of stdin if not running in a terminal
+func promptPassword(prompt string) ([]byte, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("unable to read password from stdin: %v", err)
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+	fmt.Print(prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return password, err
+}
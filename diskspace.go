@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	diskSpaceCheckInterval = 5 * time.Second
+
+	// time the download stays paused because of low disk space before it is aborted
+	lowDiskSpaceTimeout = 5 * time.Minute
+)
+
+var (
+	// true while the download is paused because of low disk space
+	downloadPaused atomic.Bool
+
+	// largest article size the required space was estimated with
+	estimatedPartSize atomic.Int64
+)
+
+// file system of the download paths with the space required on it
+type volume struct {
+	id       string
+	path     string
+	free     int64
+	required int64
+}
+
+// downloadVolumes returns the file systems of the temporary path and the destination path
+// the required space is estimated with the size of an article: the data and par2 files are written
+// to the temporary path and the extracted files (about the size of the data files) to the destination path
+func downloadVolumes(partSize int64) ([]*volume, error) {
+	var volumes []*volume
+	for _, path := range []struct {
+		path     string
+		required int64
+	}{
+		{conf.TempPath, partSize * int64(totalParts["data"]+totalParts["par2"])},
+		{conf.DestPath, 0},
+	} {
+		if path.path == conf.DestPath && conf.Unrar {
+			path.required = partSize * int64(totalParts["data"])
+		}
+		free, id, err := diskUsage(existingParent(path.path))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to determine the free disk space of \"%v\": %v", path.path, err)
+		}
+		if len(volumes) > 0 && volumes[0].id == id {
+			volumes[0].required += path.required
+			continue
+		}
+		volumes = append(volumes, &volume{id: id, path: path.path, free: free, required: path.required})
+	}
+	return volumes, nil
+}
+
+// checkDiskSpace makes sure the free space of the download paths is above MinFreeSpace
+// and (if the size of an article is known) sufficient for the download
+func checkDiskSpace(partSize int64) error {
+	volumes, err := downloadVolumes(partSize)
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if v.free-v.required < int64(conf.MinFreeSpace) {
+			if v.required > 0 {
+				return fmt.Errorf("Not enough disk space for \"%v\": about %v required, %v free (MinFreeSpace: %v)", v.path, formatBytes(v.required), formatBytes(v.free), formatBytes(int64(conf.MinFreeSpace)))
+			}
+			return fmt.Errorf("Not enough disk space for \"%v\": %v free (MinFreeSpace: %v)", v.path, formatBytes(v.free), formatBytes(int64(conf.MinFreeSpace)))
+		}
+		if v.required > 0 {
+			Log.Debug("Disk space for \"%v\": about %v required, %v free", v.path, formatBytes(v.required), formatBytes(v.free))
+		}
+	}
+	return nil
+}
+
+// estimateDiskSpace checks the disk space with the size of the largest article loaded so far,
+// so the check is repeated if an article is larger than the previous ones (e.g. the first article was the short last one of a file)
+// the loading of the articles is aborted if the space is not sufficient
+func estimateDiskSpace(partSize int64) {
+	for {
+		estimated := estimatedPartSize.Load()
+		if partSize <= estimated {
+			return
+		}
+		if estimatedPartSize.CompareAndSwap(estimated, partSize) {
+			break
+		}
+	}
+	if err := checkDiskSpace(partSize); err != nil {
+		loadError.CompareAndSwap(nil, &err)
+	}
+}
+
+// diskSpaceMonitor pauses the download while the free space of the temporary path is below MinFreeSpace
+// and aborts it if the space is not freed within lowDiskSpaceTimeout
+func diskSpaceMonitor(stop <-chan struct{}) {
+	if conf.MinFreeSpace <= 0 {
+		return
+	}
+	ticker := time.NewTicker(diskSpaceCheckInterval)
+	defer ticker.Stop()
+	defer downloadPaused.Store(false)
+	var pausedSince time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			free, _, err := diskUsage(conf.TempPath)
+			if err != nil {
+				Log.Debug("Unable to determine the free disk space of \"%v\": %v", conf.TempPath, err)
+				continue
+			}
+			low := free < int64(conf.MinFreeSpace)
+			switch {
+			case low && !downloadPaused.Load():
+				pausedSince = time.Now()
+				downloadPaused.Store(true)
+				Log.Warn("Only %v of disk space left for \"%v\" (MinFreeSpace: %v), download paused until space is freed", formatBytes(free), conf.TempPath, formatBytes(int64(conf.MinFreeSpace)))
+			case low && time.Since(pausedSince) > lowDiskSpaceTimeout:
+				err := fmt.Errorf("Not enough disk space for \"%v\": only %v left for more than %v", conf.TempPath, formatBytes(free), lowDiskSpaceTimeout)
+				loadError.CompareAndSwap(nil, &err)
+				downloadPaused.Store(false)
+				return
+			case !low && downloadPaused.Load():
+				downloadPaused.Store(false)
+				Log.Info("Disk space freed, download resumed")
+			}
+		}
+	}
+}
+
+// paused returns true while the download is paused because of low disk space or by the user
+func paused() bool {
+	return downloadPaused.Load() || userPaused.Load()
+}
+
+// waitWhilePaused blocks while the download is paused
+func waitWhilePaused() {
+	for paused() {
+		time.Sleep(time.Second)
+	}
+}
+
+// existingParent returns the path or its nearest parent that exists
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskUsage returns the free space of the file system of the path and its id
+func diskUsage(path string) (int64, string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, "", err
+	}
+	return int64(stat.Bavail) * stat.Bsize, fmt.Sprint(stat.Fsid.Val), nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskUsage returns the free space of the file system of the path and its id
+func diskUsage(path string) (int64, string, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, "", err
+	}
+	var free uint64
+	if err = windows.GetDiskFreeSpaceEx(pathPtr, &free, nil, nil); err != nil {
+		return 0, "", err
+	}
+	return int64(free), strings.ToLower(filepath.VolumeName(path)), nil
+}
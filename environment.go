@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// every configuration key can be set with an environment variable "NXG_" + key in upper case,
+// e.g. NXG_HOST, NXG_CONNECTIONS or NXG_TLSPINS (lists are comma separated).
+// The usenet servers of the "Servers" list are set with NXG_SERVERS_<n>_<KEY>,
+// e.g. NXG_SERVERS_1_HOST, where n starts at 1.
+//
+// precedence (lowest to highest): defaults, configuration file, profile, environment variables, NXGLNK, arguments
+
+const (
+	envPrefix      = "NXG_"
+	headlessEnvVar = "NXG_HEADLESS"
+)
+
+// highest server number accepted in the NXG_SERVERS_<n>_<SETTING> environment variables
+const maxServerEnvIndex = 100
+
+var serverEnvVarExp = regexp.MustCompile(`^NXG_SERVERS_(\d+)_([A-Z0-9_]+)$`)
+
+func envVarName(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+// isHeadless returns true if NXG_HEADLESS is set to true
+// in headless mode no configuration file is created and the protocol is not registered
+func isHeadless() bool {
+	headless, _ := strconv.ParseBool(os.Getenv(headlessEnvVar))
+	return headless
+}
+
+// bindEnvironment binds the environment variables to the configuration keys
+func bindEnvironment() {
+	for _, field := range configFields(reflect.ValueOf(&Args{}).Elem()) {
+		if field.key != "Servers" && field.key != "Profiles" && field.key != "Categories" {
+			viper.BindEnv(field.key, envVarName(field.key))
+		}
+	}
+	if servers := serversFromEnvironment(); servers != nil {
+		viper.Set("Servers", servers)
+	}
+}
+
+// serversFromEnvironment merges the NXG_SERVERS_<n>_<KEY> environment variables
+// into the "Servers" list of the configuration file
+func serversFromEnvironment() []interface{} {
+	serverKeys := make(map[string]string)
+	for _, field := range configFields(reflect.ValueOf(&Server{}).Elem()) {
+		serverKeys[strings.ToUpper(field.key)] = field.key
+	}
+	var envVars []string
+	for _, env := range os.Environ() {
+		if name, _, ok := strings.Cut(env, "="); ok && serverEnvVarExp.MatchString(name) {
+			envVars = append(envVars, env)
+		}
+	}
+	if len(envVars) == 0 {
+		return nil
+	}
+	sort.Strings(envVars)
+	var servers []interface{}
+	if list, ok := viper.Get("Servers").([]interface{}); ok {
+		for _, item := range list {
+			server := make(map[string]interface{})
+			if settings, ok := item.(map[string]interface{}); ok {
+				for key, value := range settings {
+					server[key] = value
+				}
+			}
+			servers = append(servers, server)
+		}
+	}
+	for _, env := range envVars {
+		name, value, _ := strings.Cut(env, "=")
+		matches := serverEnvVarExp.FindStringSubmatch(name)
+		index, err := strconv.Atoi(matches[1])
+		if err != nil || index < 1 || index > maxServerEnvIndex {
+			Log.Warn("Ignoring environment variable \"%v\": the server number must be between 1 and %v", name, maxServerEnvIndex)
+			continue
+		}
+		key, ok := serverKeys[matches[2]]
+		if !ok {
+			Log.Warn("Ignoring unknown environment variable \"%v\"", name)
+			continue
+		}
+		for len(servers) < index {
+			servers = append(servers, make(map[string]interface{}))
+		}
+		if key == "TLSPins" {
+			servers[index-1].(map[string]interface{})[strings.ToLower(key)] = strings.Split(value, ",")
+		} else {
+			servers[index-1].(map[string]interface{})[strings.ToLower(key)] = value
+		}
+	}
+	return servers
+}
+
+// environmentSource returns the environment variable the configuration key was set with (if any)
+func environmentSource(key string) (string, bool) {
+	if key == "Servers" {
+		for _, env := range os.Environ() {
+			if name, _, _ := strings.Cut(env, "="); serverEnvVarExp.MatchString(name) {
+				return "environment variables NXG_SERVERS_*", true
+			}
+		}
+		return "", false
+	}
+	if _, ok := os.LookupEnv(envVarName(key)); ok {
+		return "environment variable " + envVarName(key), true
+	}
+	return "", false
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -8,8 +9,14 @@ import (
 	"github.com/chrisfarms/yenc"
 )
 
+// decoded part of a file with the id of its article
+type filePart struct {
+	*yenc.Part
+	messageID string
+}
+
 type FileChannels struct {
-	channels map[string]chan *yenc.Part
+	channels map[string]chan filePart
 }
 
 type FileWriters struct {
@@ -17,53 +24,60 @@ type FileWriters struct {
 	writers map[string]bool
 }
 
-func (fileWriter *FileWriters) runOnce(name string) {
+// runOnce starts the writer of the file (if not already running) and returns its channel
+func (fileWriter *FileWriters) runOnce(name string) chan filePart {
 	fileWriter.Lock()
 	defer fileWriter.Unlock()
-	if _, ok := fileWriter.writers[name]; ok {
-		return
-	} else {
-		fileChannels.channels[name] = make(chan *yenc.Part, conf.Connections*2)
+	if _, ok := fileWriter.writers[name]; !ok {
+		fileChannels.channels[name] = make(chan filePart, totalConnections()*2)
 		fileWriterWG.Add(1)
 		go writeFile(fileChannels.channels[name], name, &fileWriterWG)
 		fileWriter.writers[name] = true
 	}
+	return fileChannels.channels[name]
 }
 
 var (
 	fileChannels FileChannels
 	fileWriters  FileWriters
-	writtenBytes int
 )
 
-func writeFile(parts <-chan *yenc.Part, name string, wg *sync.WaitGroup) {
+// writeFile writes the parts to the file
+// parts that cannot be written are marked as missing
+func writeFile(parts <-chan filePart, name string, wg *sync.WaitGroup) {
 
 	Log.Debug("Start writing file \"%v\"", name)
 
 	defer wg.Done()
 
-	var (
-		destFile *os.File
-		err      error
-	)
-
-	if destFile, err = os.OpenFile(filepath.Join(conf.TempPath, name), os.O_CREATE|os.O_WRONLY, 0644); err != nil {
-		Log.Error("WRITER: Unable to create file \"%v\": %v", conf.TempPath, err)
-		exit(1)
+	// the file is read to verify its slices
+	destFile, err := os.OpenFile(filepath.Join(conf.TempPath, name), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		Log.Error("WRITER: Unable to create file \"%v\": %v", filepath.Join(conf.TempPath, name), err)
+		abortErr := fmt.Errorf("Unable to create file \"%v\": %v", name, err)
+		loadError.CompareAndSwap(nil, &abortErr)
+		for part := range parts {
+			missingArticles.add(part.messageID)
+			progress.missed(name, int64(len(part.Body)))
+		}
+		return
 	}
 	defer destFile.Close()
 
-	for {
-
-		part, ok := <-parts
-		if !ok {
-			return
-		}
-		if writtenBytes, err = destFile.WriteAt(part.Body, part.Begin-1); err != nil {
+	for part := range parts {
+		writtenBytes, err := destFile.WriteAt(part.Body, part.Begin-1)
+		if err != nil {
 			Log.Warn("Unable to write bytes %v to %v to destination file \"%v\": %v", part.Begin-1, part.Begin-1+int64(len(part.Body)), part.Name, err)
+			missingArticles.add(part.messageID)
+			progress.missed(name, int64(len(part.Body)-writtenBytes))
+			checkMissingArticles()
 		}
-		if conf.Verbose > 0 {
-			downloadProgressBar.Add(writtenBytes)
+		if writtenBytes > 0 {
+			coverageOf(name).add(part.Begin-1, part.Begin-1+int64(writtenBytes))
+			if err == nil {
+				progress.written(name, int64(writtenBytes))
+			}
+			verifySlices(destFile, name, part.Begin-1, part.Begin-1+int64(writtenBytes))
 		}
 	}
 
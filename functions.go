@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"path/filepath"
 	"runtime/debug"
 )
 
@@ -14,10 +15,18 @@ func GetSHA256Hash(text string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+// homeRelativePath treats relative paths as relative to the user's home folder
+func homeRelativePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(homePath, path)
+}
+
 func checkForFatalErr(err error) {
 	if err != nil {
 		Log.Error(err.Error())
-		exit(1)
+		exit(exitCodeOf(err))
 	}
 }
 
@@ -57,4 +66,22 @@ func TryCatch(f func()) func() error {
 	}
 }
 
-func newline() { fmt.Println() }
+func newline() {
+	if interactive() {
+		fmt.Println()
+	}
+}
+
+// formatBytes formats the number of bytes with a binary unit (e.g. 1.5 GiB)
+func formatBytes(bytes int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(bytes)
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	return fmt.Sprintf("%.1f %v", value, units[i])
+}
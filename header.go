@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// separator of the fields of the decoded header
+const headerSeparator = ":"
+
+// NxG header
+//
+// the decoded header consists of at least three fields separated by colons:
+//
+//	identifier:data parts:par2 parts[:version[:additional fields of the version]]
+//
+// headers without version field are version 1, their identifier may contain colons
+type nxgHeader struct {
+	Encoded   string   // header used for the message ids: as provided for headers without version, otherwise in standard base64 encoding with padding
+	Decoded   string   // decoded header
+	ID        string   // identifier of the upload
+	DataParts int      // number of data articles
+	Par2Parts int      // number of par2 articles
+	Version   int      // version of the header (selects the message id scheme)
+	Extra     []string // additional fields of the version
+}
+
+// header of the current download
+var header nxgHeader
+
+// parseHeader decodes and validates the header
+// the header may be encoded with the standard or the URL-safe base64 alphabet, with or
+// without padding, and may contain whitespace and line breaks (e.g. from copy and paste)
+func parseHeader(encoded string) (nxgHeader, error) {
+	var h nxgHeader
+
+	encoded = strings.Join(strings.Fields(encoded), "")
+	if encoded == "" {
+		return h, errors.New("header is empty")
+	}
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(encoded, "-_") {
+		if strings.ContainsAny(encoded, "+/") {
+			return h, errors.New("header mixes the standard and the URL-safe base64 alphabet")
+		}
+		encoding = base64.RawURLEncoding
+	}
+	unpadded := strings.TrimRight(encoded, "=")
+	if padding := len(encoded) - len(unpadded); padding > 2 || (padding > 0 && (len(unpadded)+padding)%4 != 0) {
+		return h, fmt.Errorf("header has invalid base64 padding")
+	}
+	// a single character cannot encode a byte
+	if len(unpadded)%4 == 1 {
+		return h, fmt.Errorf("header is not valid base64: length %d is not possible", len(unpadded))
+	}
+	decoded, err := encoding.DecodeString(unpadded)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		if int(corrupt) < len(unpadded) {
+			return h, fmt.Errorf("header is not valid base64: invalid character '%c' at position %d", unpadded[corrupt], int(corrupt)+1)
+		}
+		return h, fmt.Errorf("header is not valid base64: length %d is not possible", len(unpadded))
+	} else if err != nil {
+		return h, fmt.Errorf("header is not valid base64: %v", err)
+	}
+	h.Encoded = base64.StdEncoding.EncodeToString(decoded)
+	h.Decoded = string(decoded)
+
+	if !utf8.Valid(decoded) {
+		return h, errors.New("decoded header is not valid text")
+	}
+	if index := strings.IndexFunc(h.Decoded, unicode.IsControl); index >= 0 {
+		return h, fmt.Errorf("decoded header contains a control character at position %d", index+1)
+	}
+	fields := strings.Split(h.Decoded, headerSeparator)
+	if len(fields) < 3 {
+		return h, fmt.Errorf("decoded header \"%v\" must consist of at least 3 fields (identifier:data parts:par2 parts) but has %d", h.Decoded, len(fields))
+	}
+	// identifiers may contain colons, the parts are then the last two fields and there is no version field
+	dataField := 1
+	if !isHeaderCount(fields[1]) || !isHeaderCount(fields[2]) {
+		dataField = len(fields) - 2
+	}
+	if h.ID = strings.Join(fields[:dataField], headerSeparator); strings.TrimSpace(h.ID) == "" {
+		return h, errors.New("identifier of the header (field 1) is empty")
+	}
+	if h.DataParts, err = parseHeaderCount(fields[dataField]); err != nil {
+		return h, fmt.Errorf("number of data parts (field %d) %v", dataField+1, err)
+	}
+	if h.DataParts == 0 {
+		return h, fmt.Errorf("number of data parts (field %d) must be at least 1", dataField+1)
+	}
+	if h.Par2Parts, err = parseHeaderCount(fields[dataField+1]); err != nil {
+		return h, fmt.Errorf("number of par2 parts (field %d) %v", dataField+2, err)
+	}
+	h.Version = 1
+	if dataField+2 == len(fields) {
+		// the message ids of headers without version are derived from the header as it was provided
+		h.Encoded = encoded
+		return h, nil
+	}
+	if h.Version, err = parseHeaderCount(fields[3]); err != nil {
+		return h, fmt.Errorf("version of the header (field 4) %v", err)
+	}
+	if h.Version == 0 {
+		return h, errors.New("version of the header (field 4) must be at least 1")
+	}
+	h.Extra = fields[4:]
+	return h, nil
+}
+
+func isHeaderCount(field string) bool {
+	_, err := parseHeaderCount(field)
+	return err == nil
+}
+
+func parseHeaderCount(field string) (int, error) {
+	if field == "" {
+		return 0, errors.New("is empty")
+	}
+	if strings.Trim(field, "0123456789") != "" {
+		return 0, fmt.Errorf("\"%v\" is not a number", field)
+	}
+	count, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, fmt.Errorf("\"%v\" is too large", field)
+	}
+	return count, nil
+}
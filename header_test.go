@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	std := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name   string
+		header string
+		want   nxgHeader
+	}{
+		{
+			name:   "plain",
+			header: std([]byte("upload:8:2")),
+			want:   nxgHeader{Encoded: std([]byte("upload:8:2")), Decoded: "upload:8:2", ID: "upload", DataParts: 8, Par2Parts: 2, Version: 1},
+		},
+		{
+			name:   "identifier with colons",
+			header: std([]byte("my:upload:10:0")),
+			want:   nxgHeader{Encoded: std([]byte("my:upload:10:0")), Decoded: "my:upload:10:0", ID: "my:upload", DataParts: 10, Par2Parts: 0, Version: 1},
+		},
+		{
+			name:   "whitespace and line breaks",
+			header: "dXBsb2Fk\r\n OjE6MA==\t",
+			want:   nxgHeader{Encoded: "dXBsb2FkOjE6MA==", Decoded: "upload:1:0", ID: "upload", DataParts: 1, Par2Parts: 0, Version: 1},
+		},
+		{
+			// headers without version are hashed as provided
+			name:   "without padding",
+			header: "dXBsb2FkOjE6MA",
+			want:   nxgHeader{Encoded: "dXBsb2FkOjE6MA", Decoded: "upload:1:0", ID: "upload", DataParts: 1, Par2Parts: 0, Version: 1},
+		},
+		{
+			name:   "url-safe with version",
+			header: base64.RawURLEncoding.EncodeToString([]byte("up>load?:5:1:1")),
+			want:   nxgHeader{Encoded: std([]byte("up>load?:5:1:1")), Decoded: "up>load?:5:1:1", ID: "up>load?", DataParts: 5, Par2Parts: 1, Version: 1, Extra: []string{}},
+		},
+		{
+			name:   "version with additional fields",
+			header: std([]byte("upload:3:1:2:salt:example.com")),
+			want:   nxgHeader{Encoded: std([]byte("upload:3:1:2:salt:example.com")), Decoded: "upload:3:1:2:salt:example.com", ID: "upload", DataParts: 3, Par2Parts: 1, Version: 2, Extra: []string{"salt", "example.com"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseHeader(test.header)
+			if err != nil {
+				t.Fatalf("parseHeader(%q) error = %v", test.header, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseHeader(%q) = %+v, want %+v", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	std := func(decoded string) string { return base64.StdEncoding.EncodeToString([]byte(decoded)) }
+	tests := []struct {
+		name   string
+		header string
+		err    string
+	}{
+		{"empty", " \r\n", "header is empty"},
+		{"mixed alphabets", "ab+c-d", "header mixes the standard and the URL-safe base64 alphabet"},
+		{"too much padding", "dXA===", "header has invalid base64 padding"},
+		{"wrong padding", "dXBs=", "header has invalid base64 padding"},
+		{"invalid character", "dXBs*G9h", "header is not valid base64: invalid character '*' at position 5"},
+		{"impossible length", "dXBsb", "header is not valid base64: length 5 is not possible"},
+		{"plain text", "upload:8:2", "header is not valid base64: invalid character ':' at position 7"},
+		{"invalid text", std("up\xffload:1:0"), "decoded header is not valid text"},
+		{"control character", std("up\tload:1:0"), "decoded header contains a control character at position 3"},
+		{"too few fields", std("upload:8"), "decoded header \"upload:8\" must consist of at least 3 fields (identifier:data parts:par2 parts) but has 2"},
+		{"empty identifier", std(":8:0"), "identifier of the header (field 1) is empty"},
+		{"empty data parts", std("upload::0"), "number of data parts (field 2) is empty"},
+		{"data parts not a number", std("upload:x:0"), "number of data parts (field 2) \"x\" is not a number"},
+		{"no data parts", std("upload:0:1"), "number of data parts (field 2) must be at least 1"},
+		{"too many data parts", std("upload:99999999999999999999:0"), "number of data parts (field 2) \"99999999999999999999\" is too large"},
+		{"par2 parts not a number", std("my:upload:8:-1"), "number of par2 parts (field 4) \"-1\" is not a number"},
+		{"version not a number", std("upload:8:0:v2"), "version of the header (field 4) \"v2\" is not a number"},
+		{"version zero", std("upload:8:0:0"), "version of the header (field 4) must be at least 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseHeader(test.header)
+			if err == nil || err.Error() != test.err {
+				t.Errorf("parseHeader(%q) error = %v, want %q", test.header, err, test.err)
+			}
+		})
+	}
+}
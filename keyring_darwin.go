@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// the macOS Keychain is accessed with the security command
+
+func keyringGet(service string, account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to read \"%v\" from the keychain: %v %v", account, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// the password is not passed as argument (it would be visible in the process list):
+// without a value for -w the security command prompts for the password and its confirmation,
+// which are read from stdin as the command has no controlling terminal
+func keyringSet(service string, account string, password string) error {
+	if strings.ContainsAny(password, "\r\n") {
+		return fmt.Errorf("unable to store \"%v\" in the keychain: the password contains a line break", account)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", service, "-a", account, "-w")
+	cmd.Stdin = strings.NewReader(password + "\n" + password + "\n")
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unable to store \"%v\" in the keychain: %v %v", account, err, strings.TrimSpace(stderr.String()))
+	}
+	// make sure the password was read from stdin
+	if stored, err := keyringGet(service, account); err != nil || stored != password {
+		return fmt.Errorf("unable to store \"%v\" in the keychain: the password could not be passed to the security command", account)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// the Secret Service is accessed with secret-tool (libsecret)
+
+func keyringGet(service string, account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to read \"%v\" from the keyring: %v %v", account, err, strings.TrimSpace(stderr.String()))
+	}
+	if len(output) == 0 {
+		return "", fmt.Errorf("no password for \"%v\" found in the keyring", account)
+	}
+	return string(output), nil
+}
+
+func keyringSet(service string, account string, password string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%v: %v", appName, account), "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(password)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unable to store \"%v\" in the keyring: %v %v", account, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
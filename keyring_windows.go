@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// the Windows Credential Manager is accessed with the CredRead/CredWrite API
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+var (
+	advapi32       = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+func keyringTarget(service string, account string) (*uint16, error) {
+	return windows.UTF16PtrFromString(service + ":" + account)
+}
+
+func keyringGet(service string, account string) (string, error) {
+	target, err := keyringTarget(service, account)
+	if err != nil {
+		return "", err
+	}
+	var credential *winCredential
+	if ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&credential))); ret == 0 {
+		return "", fmt.Errorf("unable to read \"%v\" from the credential manager: %v", account, err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(credential)))
+	return string(unsafe.Slice(credential.CredentialBlob, credential.CredentialBlobSize)), nil
+}
+
+func keyringSet(service string, account string, password string) error {
+	target, err := keyringTarget(service, account)
+	if err != nil {
+		return err
+	}
+	userName, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	blob := []byte(password)
+	credential := winCredential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		UserName:           userName,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+	}
+	if len(blob) > 0 {
+		credential.CredentialBlob = &blob[0]
+	}
+	if ret, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&credential)), 0); ret == 0 {
+		return fmt.Errorf("unable to store \"%v\" in the credential manager: %v", account, err)
+	}
+	return nil
+}
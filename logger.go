@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/acarl005/stripansi"
 )
@@ -20,9 +22,10 @@ type Logger struct {
 
 // global error logger variables
 var (
-	logFile *os.File
-	logger  *log.Logger
-	Log     = Logger{
+	logFile   *os.File
+	logger    *log.Logger
+	lastError atomic.Value // last logged error message (for the notifications)
+	Log       = Logger{
 		Error: logError,
 		Warn:  logWarn,
 		Info:  logInfo,
@@ -56,10 +59,11 @@ func logEntry(logType string, logText string, vars ...interface{}) {
 
 	// log error
 	if logType == "error" {
+		lastError.Store(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 		if logger != nil {
 			logger.Printf("ERROR:   %s\n", stripansi.Strip(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n")))
 		}
-		fmt.Fprintf(os.Stderr, "ERROR:   %s\n", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
+		printLog(os.Stderr, "ERROR", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 	}
 
 	// log warn
@@ -68,7 +72,7 @@ func logEntry(logType string, logText string, vars ...interface{}) {
 			logger.Printf("WARNING: %s\n", stripansi.Strip(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n")))
 		}
 		if conf.Verbose > 1 {
-			fmt.Printf("WARNING: %s\n", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
+			printLog(os.Stdout, "WARNING", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 		}
 	}
 
@@ -78,7 +82,7 @@ func logEntry(logType string, logText string, vars ...interface{}) {
 			logger.Printf("INFO:    %s\n", stripansi.Strip(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n")))
 		}
 		if conf.Verbose > 0 {
-			fmt.Printf("INFO:    %s\n", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
+			printLog(os.Stdout, "INFO", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 		}
 	}
 
@@ -88,7 +92,7 @@ func logEntry(logType string, logText string, vars ...interface{}) {
 			logger.Printf("SUCCESS: %s\n", stripansi.Strip(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n")))
 		}
 		if conf.Verbose > 0 {
-			fmt.Printf("SUCCESS: %s\n", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
+			printLog(os.Stdout, "SUCCESS", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 		}
 	}
 
@@ -98,12 +102,25 @@ func logEntry(logType string, logText string, vars ...interface{}) {
 			logger.Printf("DEBUG:   %s\n", stripansi.Strip(strings.Trim(fmt.Sprintf(logText, vars...), " \r\n")))
 		}
 		if conf.Verbose > 2 {
-			fmt.Printf("DEBUG:   %s\n", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
+			printLog(os.Stdout, "DEBUG", strings.Trim(fmt.Sprintf(logText, vars...), " \r\n"))
 		}
 	}
 
 }
 
+// printLog writes the message to the terminal, to the log section of the terminal interface
+// or as JSON event if the output format is json
+func printLog(w io.Writer, label string, message string) {
+	if jsonOutput() {
+		emitEvent("log", map[string]interface{}{"level": strings.ToLower(label), "message": stripansi.Strip(message)})
+		return
+	}
+	line := fmt.Sprintf("%-9s%s\n", label+":", message)
+	if !tui.log(w, line) {
+		fmt.Fprint(w, line)
+	}
+}
+
 func initLogger(path string) {
 	var err error
 	if err = os.MkdirAll(path, os.ModePerm); err != nil {
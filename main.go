@@ -1,21 +1,16 @@
 package main
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"io/fs"
-	"math"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/chrisfarms/yenc"
-	"github.com/schollz/progressbar/v3"
 )
 
 // global variables
@@ -25,22 +20,20 @@ var (
 	logFileName    = "nxg-loader.log"
 	configFileName = "nxg-loader.conf"
 
-	appExec             string
-	appPath             string
-	homePath            string
-	decodedHeader       []byte
-	totalParts          = make(map[string]int, 2)
-	downloadProgressBar *progressbar.ProgressBar
-	err                 error
+	appExec    string
+	appPath    string
+	homePath   string
+	workPath   string
+	totalParts = make(map[string]int, 2)
+	err        error
 
 	// wait groups
-	fileWriterWG   sync.WaitGroup
-	readArticlesWG sync.WaitGroup
+	fileWriterWG      sync.WaitGroup
+	readArticlesWG    sync.WaitGroup
+	pendingArticlesWG sync.WaitGroup
 
 	// counters
 	failedConnections atomic.Int64
-	totalBytesLoaded  atomic.Int64
-	totalPartsLoaded  atomic.Int64
 )
 
 func init() {
@@ -56,6 +49,7 @@ func init() {
 	}
 
 	// change working directory
+	workPath, _ = os.Getwd()
 	// important for url protocol handling (otherwise work dir will be system32 on windows)
 	if err := os.Chdir(appPath); err != nil {
 		Log.Error("Cannot change working directory: ", err)
@@ -75,162 +69,364 @@ func main() {
 		defer logClose()
 	}
 	parseArguments()
-	checkArguments()
+	runCommand()
 
-	// decode header
-	if decodedHeader, err = base64.StdEncoding.DecodeString(conf.Header); err != nil {
-		Log.Error("Provided header is invalid")
-		exit(1)
+}
+
+func download() {
+
+	startTUI()
+	notify("Download started", downloadName())
+	repaired, err := downloadFiles()
+	if err != nil {
+		Log.Error(err.Error())
+		exit(exitCodeOf(err))
+	}
+	if repaired {
+		exit(exitRepaired)
+	}
+	exit(exitSuccess)
+
+}
+
+// downloadFiles downloads, repairs and extracts the files of the current header
+// and moves them to the destination path, repaired is true if the files had to be repaired
+func downloadFiles() (repaired bool, err error) {
+
+	if conf.Category != "" {
+		Log.Info("Category: %v", conf.Category)
+	}
+	if !parsedLink.PostDate.IsZero() {
+		Log.Info("Posted on: %v", parsedLink.PostDate.Format(time.DateOnly))
+	}
+	if len(parsedLink.Newsgroups) > 0 {
+		Log.Info("Newsgroups: %v", strings.Join(parsedLink.Newsgroups, ", "))
 	}
 
 	// make paths
 	if err = os.MkdirAll(conf.TempPath, os.ModePerm); err != nil {
-		Log.Error("Unable to create temporary path \"%v\": %v", conf.TempPath, err)
-		exit(1)
+		return false, fmt.Errorf("Unable to create temporary path \"%v\": %v", conf.TempPath, err)
 	}
 	if err = os.MkdirAll(conf.DestPath, os.ModePerm); err != nil {
-		Log.Error("Unable to create destination path \"%v\": %v", conf.DestPath, err)
-		exit(1)
+		return false, fmt.Errorf("Unable to create destination path \"%v\": %v", conf.DestPath, err)
 	}
 
-	exp, err := regexp.Compile(`.+:(\d+):(\d+)`)
-	if err != nil {
-		Log.Error("%v", err)
-	}
-	if exp.MatchString(string(decodedHeader)) {
-		matches := exp.FindAllStringSubmatch(string(decodedHeader), -1)
-		totalParts["data"], _ = strconv.Atoi(matches[0][1])
-		Log.Debug("Total data parts: %v", totalParts["data"])
-		totalParts["par2"], _ = strconv.Atoi(matches[0][2])
-		Log.Debug("Total par2 parts: %v", totalParts["par2"])
-		loadArticles("data")
-		Log.Info("Download of data files completed")
-	} else {
-		Log.Error("Provided header is invalid")
-		exit(1)
+	estimatedPartSize.Store(0)
+	if err = checkDiskSpace(0); err != nil {
+		return false, err
+	}
+
+	missingArticles.reset()
+	resetCoverage()
+	loadedArticles.reset()
+	knownFiles.reset()
+	setPar2Index(nil)
+	articleCache.limitSize()
+
+	// the par2 index file is small and needed for every repair, with it the data files are verified while they are loaded
+	par2First := conf.Par2IndexFirst && totalParts["par2"] > 0
+	if par2First {
+		if err = loadPar2Index(); err != nil {
+			Log.Warn("Unable to load the par2 index file: %v", err)
+		}
+		// a missing par2 article does not make the data files incomplete, it is tried again with the other par2 files
+		missingArticles.reset()
 	}
 
-	if len(missingArticles.parts) > 0 {
-		Log.Info("Missing parts: %v", len(missingArticles.parts))
-		Log.Info("Downloaded files are incomplete and need to be repaired")
-		if totalParts["par2"] > 0 {
-			loadArticles("par2")
-			Log.Info("Download of par2 files completed")
-			if conf.Repair {
-				if err = par2(); err != nil {
-					Log.Error("Error while repairing: %v", err)
-					moveFiles()
-					exit(1)
+	if err = loadArticles("data"); err != nil {
+		return false, err
+	}
+	Log.Info("Download of data files completed")
+
+	// the files need to be repaired if articles are missing, bytes were not written or slices are damaged
+	incomplete := incompleteFiles("data")
+	total, verified, damaged := verifiedFiles()
+	if total > 0 {
+		Log.Info("Files verified with the par2 index file: %d of %d", verified, total)
+	}
+	if missingArticles.len() > 0 || len(incomplete) > 0 || len(damaged) > 0 {
+		if missingArticles.len() > 0 {
+			Log.Info("Missing parts: %v", missingArticles.len())
+		}
+		logIncompleteFiles(incomplete)
+		for _, name := range damaged {
+			Log.Info("Damaged file \"%v\"", name)
+		}
+		Log.Info("Downloaded files are incomplete or damaged and need to be repaired")
+		if totalParts["par2"] == 0 {
+			if err = moveFiles(); err != nil {
+				Log.Error(err.Error())
+			}
+			return false, withExitCode(exitRepairFailed, fmt.Errorf("No par2 files provided. Repair not possible."))
+		}
+		if err = loadArticles("par2"); err != nil {
+			return false, err
+		}
+		Log.Info("Download of par2 files completed")
+		if conf.Repair {
+			if err = par2(); err != nil {
+				if err := moveFiles(); err != nil {
+					Log.Error(err.Error())
 				}
+				return false, withExitCode(exitRepairFailed, fmt.Errorf("Error while repairing: %v", err))
 			}
+			repaired = true
 		} else {
-			Log.Error("No par2 files provided. Repair not possible.")
-			moveFiles()
-			exit(1)
+			if err = moveFiles(); err != nil {
+				Log.Error(err.Error())
+			}
+			return false, withExitCode(exitRepairFailed, fmt.Errorf("Downloaded files are incomplete or damaged and repair is disabled"))
 		}
 	}
 
+	// the par2 files loaded in advance are not needed
+	if par2First && !repaired && conf.DeletePar2 {
+		deletePar2Files()
+	}
+
+	// the files are moved even if they could not be extracted
+	var extractErr error
 	if conf.Unrar {
 		if err = unrar(); err != nil {
-			Log.Error("Error while extracting rar archive: %v", err)
+			extractErr = withExitCode(exitExtractFailed, fmt.Errorf("Error while extracting rar archive: %v", err))
 		}
 	}
 
-	moveFiles()
-	exit(0)
+	if err = moveFiles(); err != nil {
+		return repaired, err
+	}
+	return repaired, extractErr
 
 }
 
-func loadArticles(partType string) {
+// loadPar2Index loads the par2 index file ("name.par2" without ".volNN+NN") of the par2 files
+// and reads the checksums of the data files from it
+// the names of the par2 files are only known after one of their articles was loaded,
+// so the first, the last and evenly spaced articles are loaded together to find the index file
+func loadPar2Index() error {
+	Log.Info("Loading par2 index file")
+	if err := loadArticleIndices("par2", par2Probes(totalParts["par2"], min(totalConnections(), maxPar2Probes))); err != nil {
+		return err
+	}
+	file, ok := smallestPar2File(knownFiles.list("par2"))
+	if !ok {
+		return fmt.Errorf("no par2 file found")
+	}
+	if !isPar2Index(file.name) {
+		// every par2 file contains the checksums of the data files
+		Log.Debug("Par2 index file not found, using the smallest par2 file found instead")
+	}
+	Log.Debug("Par2 file \"%v\": articles %d to %d", file.name, file.first, file.last)
+	var indices []int
+	for index := file.first; index <= file.last; index++ {
+		indices = append(indices, index)
+	}
+	if err := loadArticleIndices("par2", indices); err != nil {
+		return err
+	}
+	set, err := readPar2Set(filepath.Join(conf.TempPath, file.name))
+	if err != nil {
+		return fmt.Errorf("unable to read \"%v\": %v", file.name, err)
+	}
+	setPar2Index(set)
+	Log.Debug("Checksums of %d files loaded from \"%v\"", len(set.files), file.name)
+	return nil
+}
 
-	Log.Info("Loading %v files", partType)
+// maximum number of par2 articles loaded to find the par2 index file
+const maxPar2Probes = 8
+
+// par2Probes returns the first, the last and evenly spaced articles of the par2 files
+// (count articles, at least the first and the last)
+func par2Probes(total int, count int) []int {
+	count = min(max(count, 2), total)
+	var indices []int
+	for i := 0; i < count; i++ {
+		index := 1
+		if count > 1 {
+			index = 1 + i*(total-1)/(count-1)
+		}
+		if !slices.Contains(indices, index) {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
+
+// smallestPar2File returns the par2 index file, or the par2 file with the fewest articles if it is not known
+func smallestPar2File(files []fileRange) (fileRange, bool) {
+	var (
+		smallest fileRange
+		found    bool
+	)
+	for _, file := range files {
+		if isPar2Index(file.name) {
+			return file, true
+		}
+		if !found || file.last-file.first < smallest.last-smallest.first {
+			smallest, found = file, true
+		}
+	}
+	return smallest, found
+}
+
+// isPar2Index returns true if the file is a par2 index file
+func isPar2Index(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".par2") && !par2VolumeExp.MatchString(name)
+}
+
+var par2VolumeExp = regexp.MustCompile(`(?i)\.vol\d+[+-]\d+\.par2$`)
 
-	// progress bar
-	if conf.Verbose > 0 {
-		// initially set the target to max int64, we will estimate the "correct" target later
-		downloadProgressBar = progressbar.NewOptions64(math.MaxInt64,
-			progressbar.OptionSetDescription("INFO:    Downloading        "),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-			progressbar.OptionOnCompletion(newline),
-		)
+// downloadName returns the title of the download (or the header if there is no title)
+func downloadName() string {
+	if conf.Title != "" {
+		return conf.Title
 	}
+	return conf.Header
+}
+
+// decodeHeader decodes the header and reads the number of data and par2 parts
+func decodeHeader() {
+	if err := readHeader(); err != nil {
+		Log.Error("Provided header is invalid: %v", err)
+		os.Exit(exitInvalidInput)
+	}
+}
+
+func readHeader() error {
+	var err error
+	if header, err = parseHeader(conf.Header); err != nil {
+		return err
+	}
+	conf.Header = header.Encoded
+	totalParts["data"] = header.DataParts
+	Log.Debug("Total data parts: %v", totalParts["data"])
+	totalParts["par2"] = header.Par2Parts
+	Log.Debug("Total par2 parts: %v", totalParts["par2"])
+	Log.Debug("Header version: %v", header.Version)
+	if idScheme, err = messageIDSchemeFor(header.Version); err != nil {
+		return err
+	}
+	if len(header.Extra) > 0 {
+		Log.Debug("Additional header fields: %v", strings.Join(header.Extra, ", "))
+	}
+	return nil
+}
+
+// loadArticles downloads the articles of the part type with the connections of the connection pool
+func loadArticles(partType string) error {
+	Log.Info("Loading %v files", partType)
+	return loadArticleIndices(partType, nil)
+}
+
+// loadArticleIndices downloads the articles of the part type with the indices (all if nil)
+// the articles already loaded by the current download are skipped
+func loadArticleIndices(partType string, indices []int) error {
+
+	stage.set(fmt.Sprintf("Downloading %v files", partType))
+
+	scheduler = newArticleScheduler(partType, indices)
+	progress.start(partType, scheduler.count())
 
 	// empty files channel
 	fileChannels.channels = nil
 	fileWriters.writers = nil
 
 	// initialise channels
-	fileChannels.channels = make(map[string]chan *yenc.Part)
+	fileChannels.channels = make(map[string]chan filePart)
 	fileWriters.writers = make(map[string]bool)
 
 	// empty counters
-	totalBytesLoaded.Store(0)
-	totalPartsLoaded.Store(0)
-
-	// launche the go-routines
-	for i := 1; i <= conf.Connections; i++ {
-		readArticlesWG.Add(1)
-		go readArticles(&readArticlesWG, i, 0)
-	}
+	loadError.Store(nil)
+
+	// start the watchdog for stalled connections
+	stopWatchdog := make(chan struct{})
+	go connectionWatchdog(stopWatchdog)
+	go diskSpaceMonitor(stopWatchdog)
+	go progressEvents(stopWatchdog)
+	defer close(stopWatchdog)
+
+	// the connections are kept open for the following downloads
+	startConnections.Do(func() {
+		speedLimiter.limit.Store(int64(conf.SpeedLimit))
+		articlesChan = make(chan Article, 0)
+		connNumber := 0
+		for _, server := range servers {
+			for i := 1; i <= server.Connections; i++ {
+				connNumber++
+				readArticlesWG.Add(1)
+				go readArticles(&readArticlesWG, server, connNumber, 0)
+			}
+		}
+	})
 
-	for j := 1; j <= totalParts[partType]; j++ {
-		md5Hash := GetSHA256Hash(fmt.Sprintf("%v:%v:%v", conf.Header, partType, j))
-		messageId := md5Hash[:40] + "@" + md5Hash[40:61] + "." + md5Hash[61:]
-		articlesChan <- Article{messageId, 0, partType}
+	for loadError.Load() == nil {
+		index, ok := scheduler.pick()
+		if !ok {
+			break
+		}
+		pendingArticlesWG.Add(1)
+		articlesChan <- Article{id: messageID(partType, index), partType: partType, index: index}
 	}
 
-	close(articlesChan)
-	readArticlesWG.Wait()
+	// wait until all articles are loaded or marked as missing, as failed articles are added back to the queue
+	pendingArticlesWG.Wait()
 	for _, channel := range fileChannels.channels {
 		close(channel)
 	}
 	fileWriterWG.Wait()
-	if conf.Verbose > 0 {
-		downloadProgressBar.Finish()
+	progress.finish()
+	if hits, misses := articleCache.stats(); hits > 0 {
+		Log.Info("%d of %d articles loaded from the article cache", hits, hits+misses)
 	}
-	return
-}
-
-func moveFiles() {
-	Log.Info("Moving files to \"%v\"", conf.DestPath)
-	if err = filepath.WalkDir(conf.TempPath, func(filePath string, dir fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !dir.IsDir() {
-			if err = os.Rename(filePath, filepath.Join(conf.DestPath, filepath.Base(filePath))); err != nil {
-				return err
-			}
-		}
-		return nil
-	}); err != nil {
-		Log.Error("Error while moving files from \"%v\" to \"%v\": %v", conf.TempPath, conf.DestPath, err)
-		exit(1)
+	if err := loadError.Load(); err != nil {
+		return *err
 	}
+	return nil
 }
 
 // always use exit function to terminate
 // cmd window will stay open for the configured time if the program was startet outside a cmd window
 func exit(exitCode int) {
 
+	stopTUI()
+
+	// the results of the batch are shown even if it is aborted
+	if command == "batch" && len(batchItems) > 0 {
+		if code := showBatchSummary(); exitCode == 0 {
+			exitCode = code
+		}
+	}
+
+	// the other commands work on existing directories or do not download anything
+	if command != "download" {
+		os.Exit(exitCode)
+	}
+
 	// clean up
 	Log.Debug("Deleting temporary folder \"%v\"", conf.TempPath)
 	if err = os.RemoveAll(conf.TempPath); err != nil {
 		Log.Warn("Error while deleting temporary folder: %v", err)
 	}
 
-	if exitCode > 0 {
+	runCategoryScript(successful(exitCode))
+
+	if !successful(exitCode) {
+		message, _ := lastError.Load().(string)
 		Log.Error("Download failed")
+		notify("Download failed", downloadName()+": "+message)
+		emitResult(exitCode, errors.New(message))
 	} else {
 		Log.Succ("Download successful")
+		notify("Download completed", downloadName())
+		emitResult(exitCode, nil)
 	}
 
-	if conf.EndWaitTime {
-		waitTime := conf.SuccessWaitTime
-		if exitCode > 0 {
-			waitTime = conf.ErrorWaitTime
+	// the countdown is only shown in a terminal
+	if conf.EndWaitTime && !conf.Headless && interactive() {
+		waitTime := int(time.Duration(conf.SuccessWaitTime).Seconds())
+		if !successful(exitCode) {
+			waitTime = int(time.Duration(conf.ErrorWaitTime).Seconds())
 		}
 
 		// pause before ending the program
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// messageIDScheme derives the message ids of the articles from the header
+// new header versions (e.g. with another hash, salt or domain format) register their own scheme
+type messageIDScheme interface {
+	// messageID returns the message id of the article of the part with the index (starting with 1)
+	messageID(h nxgHeader, partType string, index int) string
+}
+
+// message id schemes by header version
+var messageIDSchemes = map[int]messageIDScheme{}
+
+// scheme of the current download
+var idScheme messageIDScheme
+
+func registerMessageIDScheme(version int, scheme messageIDScheme) {
+	if _, exists := messageIDSchemes[version]; exists {
+		panic(fmt.Sprintf("message id scheme for header version %d registered twice", version))
+	}
+	messageIDSchemes[version] = scheme
+}
+
+func init() {
+	registerMessageIDScheme(1, sha256Scheme{})
+}
+
+// messageIDSchemeFor returns the scheme of the header version
+func messageIDSchemeFor(version int) (messageIDScheme, error) {
+	if scheme, ok := messageIDSchemes[version]; ok {
+		return scheme, nil
+	}
+	var versions []string
+	for _, v := range messageIDVersions() {
+		versions = append(versions, fmt.Sprint(v))
+	}
+	return nil, fmt.Errorf("header version %d is not supported (supported versions: %v)", version, strings.Join(versions, ", "))
+}
+
+// messageIDVersions returns the header versions with a message id scheme in ascending order
+func messageIDVersions() []int {
+	var versions []int
+	for v := range messageIDSchemes {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// messageID returns the message id of the article of the part with the index
+func messageID(partType string, index int) string {
+	return idScheme.messageID(header, partType, index)
+}
+
+// version 1: SHA-256 of "header:partType:index" split into "[:40]@[40:61].[61:]"
+type sha256Scheme struct{}
+
+func (sha256Scheme) messageID(h nxgHeader, partType string, index int) string {
+	hash := GetSHA256Hash(fmt.Sprintf("%v:%v:%v", h.Encoded, partType, index))
+	return hash[:40] + "@" + hash[40:61] + "." + hash[61:]
+}
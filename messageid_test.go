@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMessageIDVersion1(t *testing.T) {
+	tests := []struct {
+		header   string
+		partType string
+		index    int
+		want     string
+	}{
+		{"dXBsb2FkOjg6Mg==", "data", 1, "0260820b0619ee2ecfcfe497c2191947ccf5f959@ba2be1970db303c2e7f3f.506"},
+		{"dXBsb2FkOjg6Mg==", "data", 8, "88149dfce867c28d3895d4e63ba25243274b5c58@c1b4c38a2080eaa010162.7aa"},
+		{"dXBsb2FkOjg6Mg==", "par2", 1, "947b4576f377bb9c9d25671a3eef9254d09bc9b9@e1ebb62e246d6e8066605.5b5"},
+		// identifier with colons
+		{"bXk6dXBsb2FkOjEwOjA=", "data", 10, "6f3e68c6618d165b5d832dc557e195fe2c78f9e2@9a3e02b194e142841354b.d8a"},
+	}
+	for _, test := range tests {
+		h, err := parseHeader(test.header)
+		if err != nil {
+			t.Fatalf("parseHeader(%q) error = %v", test.header, err)
+		}
+		scheme, err := messageIDSchemeFor(h.Version)
+		if err != nil {
+			t.Fatalf("messageIDSchemeFor(%d) error = %v", h.Version, err)
+		}
+		if got := scheme.messageID(h, test.partType, test.index); got != test.want {
+			t.Errorf("messageID(%q, %v, %d) = %v, want %v", test.header, test.partType, test.index, got, test.want)
+		}
+	}
+}
+
+// withSchemes registers additional schemes for the test
+func withSchemes(t *testing.T, versions ...int) {
+	t.Helper()
+	saved := messageIDSchemes
+	messageIDSchemes = make(map[int]messageIDScheme)
+	for version, scheme := range saved {
+		messageIDSchemes[version] = scheme
+	}
+	t.Cleanup(func() { messageIDSchemes = saved })
+	for _, version := range versions {
+		registerMessageIDScheme(version, sha256Scheme{})
+	}
+}
+
+func TestMessageIDSchemeUnknownVersion(t *testing.T) {
+	withSchemes(t, 10, 2)
+	_, err := messageIDSchemeFor(3)
+	if want := "header version 3 is not supported (supported versions: 1, 2, 10)"; err == nil || err.Error() != want {
+		t.Errorf("messageIDSchemeFor(3) error = %v, want %q", err, want)
+	}
+}
+
+func TestRegisterMessageIDSchemeTwice(t *testing.T) {
+	withSchemes(t)
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a scheme for version 1 again did not panic")
+		}
+	}()
+	registerMessageIDScheme(1, sha256Scheme{})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// policies for files that already exist in the destination path
+const (
+	conflictSkip      = "skip"      // keep the existing file
+	conflictOverwrite = "overwrite" // replace the existing file
+	conflictRename    = "rename"    // add a number to the name of the moved file
+	conflictHash      = "hash"      // keep the existing file if it is identical, otherwise rename
+)
+
+var conflictPolicies = []string{conflictSkip, conflictOverwrite, conflictRename, conflictHash}
+
+// what happened to a file
+const (
+	moveMoved       = "moved"
+	moveOverwritten = "overwritten"
+	moveRenamed     = "renamed"
+	moveSkipped     = "skipped"
+	moveIdentical   = "skipped (identical)"
+)
+
+// moveFiles moves the files of the temporary path to the destination path
+// the directory structure is preserved and existing files are handled according to conf.ConflictPolicy
+func moveFiles() error {
+	Log.Info("Moving files to \"%v\"", conf.DestPath)
+	stage.set("Moving files")
+	results := make(map[string][]string)
+	var order []string
+	if err := filepath.WalkDir(conf.TempPath, func(filePath string, dir fs.DirEntry, err error) error {
+		if err != nil || dir.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(conf.TempPath, filePath)
+		if err != nil {
+			return err
+		}
+		target, result, err := moveFile(filePath, filepath.Join(conf.DestPath, relPath))
+		if err != nil {
+			return err
+		}
+		if _, ok := results[result]; !ok {
+			order = append(order, result)
+		}
+		if result == moveMoved {
+			Log.Debug("Moved \"%v\" to \"%v\"", relPath, target)
+			results[result] = append(results[result], relPath)
+		} else {
+			results[result] = append(results[result], fmt.Sprintf("%v -> %v", relPath, target))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("Error while moving files from \"%v\" to \"%v\": %v", conf.TempPath, conf.DestPath, err)
+	}
+
+	// summary
+	for _, result := range order {
+		Log.Info("Files %v: %d", result, len(results[result]))
+		if result != moveMoved {
+			for _, file := range results[result] {
+				Log.Info("  %v", file)
+			}
+		}
+	}
+	return nil
+}
+
+// moveFile moves the file to the target and returns where it was moved to and what happened
+func moveFile(source string, target string) (string, string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", "", err
+	}
+	result := moveMoved
+	if _, err := os.Stat(target); err == nil {
+		switch conf.ConflictPolicy {
+		case conflictSkip:
+			return target, moveSkipped, nil
+		case conflictOverwrite, "":
+			// configurations without policy keep overwriting like former versions
+			result = moveOverwritten
+		case conflictHash:
+			identical, err := sameContent(source, target)
+			if err != nil {
+				return "", "", err
+			}
+			if identical {
+				return target, moveIdentical, nil
+			}
+			fallthrough
+		default:
+			if target, err = freeName(target); err != nil {
+				return "", "", err
+			}
+			result = moveRenamed
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", "", err
+	}
+	return target, result, os.Rename(source, target)
+}
+
+// freeName returns the path with a number added to the name ("name (1).ext") that does not exist yet
+func freeName(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; i < 10000; i++ {
+		candidate := fmt.Sprintf("%v (%d)%v", base, i, ext)
+		if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name found for \"%v\"", path)
+}
+
+// sameContent compares the size and the SHA-256 hash of the files
+func sameContent(a string, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+	hashA, err := fileHash(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := fileHash(b)
+	if err != nil {
+		return false, err
+	}
+	return hashA == hashB, nil
+}
+
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
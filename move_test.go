@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFileConflictPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		source  string
+		result  string
+		target  string
+		content string // content of the existing file afterwards
+	}{
+		{"", "new", moveOverwritten, "file.bin", "new"},
+		{conflictOverwrite, "new", moveOverwritten, "file.bin", "new"},
+		{conflictSkip, "new", moveSkipped, "file.bin", "old"},
+		{conflictRename, "new", moveRenamed, "file (1).bin", "old"},
+		{conflictHash, "old", moveIdentical, "file.bin", "old"},
+		{conflictHash, "new", moveRenamed, "file (1).bin", "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.policy+"/"+test.source, func(t *testing.T) {
+			withConf(t, func() { conf.ConflictPolicy = test.policy })
+			dir := t.TempDir()
+			source, existing := filepath.Join(dir, "temp", "file.bin"), filepath.Join(dir, "dest", "file.bin")
+			for file, content := range map[string]string{source: test.source, existing: "old"} {
+				os.MkdirAll(filepath.Dir(file), os.ModePerm)
+				if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			target, result, err := moveFile(source, existing)
+			if err != nil {
+				t.Fatalf("moveFile() error = %v", err)
+			}
+			if result != test.result || target != filepath.Join(dir, "dest", test.target) {
+				t.Errorf("moveFile() = %v, %v, want %v, %v", filepath.Base(target), result, test.target, test.result)
+			}
+			if content, _ := os.ReadFile(existing); string(content) != test.content {
+				t.Errorf("existing file contains %q, want %q", content, test.content)
+			}
+		})
+	}
+}
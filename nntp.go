@@ -1,60 +1,187 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"strconv"
+	"io"
+	"net"
+	"net/textproto"
 	"sync"
-
-	"github.com/Tensai75/nntp"
+	"sync/atomic"
+	"time"
 )
 
 type safeConn struct {
-	mutex  sync.Mutex
-	closed bool
-	*nntp.Conn
+	mutex    sync.Mutex
+	closed   bool
+	server   *Server
+	netConn  net.Conn
+	text     *textproto.Conn
+	lastRead atomic.Int64 // unix nano time of the last successful read from the server
+	busy     atomic.Bool  // true while a command is waiting for or reading the server response
 }
 
-var (
-	initConnGuard   sync.Once
-	connectionGuard chan struct{}
-)
+// idleReader refreshes the read deadline of the connection on every read
+// so that a server that stops sending data aborts the read after conf.ReadTimeout
+type idleReader struct {
+	conn *safeConn
+}
 
-func ConnectNNTP() (*safeConn, error) {
-	initConnGuard.Do(func() {
-		connectionGuard = make(chan struct{}, conf.Connections)
-	})
-	connectionGuard <- struct{}{} // will block if guard channel is already filled
-	var conn *nntp.Conn
-	var err error
-	if conf.SSL {
-		conn, err = nntp.DialTLS("tcp", conf.Host+":"+strconv.Itoa(conf.Port), nil)
-	} else {
-		conn, err = nntp.Dial("tcp", conf.Host+":"+strconv.Itoa(conf.Port))
+func (r idleReader) Read(p []byte) (int, error) {
+	if conf.ReadTimeout > 0 {
+		r.conn.netConn.SetReadDeadline(time.Now().Add(time.Duration(conf.ReadTimeout)))
 	}
-	safeConn := safeConn{
-		Conn: conn,
+	n, err := r.conn.netConn.Read(p)
+	if n > 0 {
+		r.conn.lastRead.Store(time.Now().UnixNano())
 	}
-	if err != nil {
+	return n, err
+}
+
+func (r idleReader) Write(p []byte) (int, error) {
+	return r.conn.netConn.Write(p)
+}
+
+func (r idleReader) Close() error {
+	return r.conn.netConn.Close()
+}
+
+func ConnectNNTP(server *Server) (*safeConn, error) {
+	server.guard <- struct{}{} // will block if guard channel is already filled
+	var err error
+	safeConn := safeConn{server: server}
+	if safeConn.netConn, err = dialServer(server); err != nil {
 		safeConn.Close()
-		return nil, fmt.Errorf("Connection to usenet server failed: %v\r\n", err)
+		return nil, fmt.Errorf("Connection to usenet server \"%v\" failed: %v\r\n", server, err)
+	}
+	if server.SSL {
+		if safeConn.netConn, err = tlsHandshake(safeConn.netConn, server); err != nil {
+			safeConn.Close()
+			return nil, err
+		}
 	}
-	if err = safeConn.Authenticate(conf.NntpUser, conf.NntpPass); err != nil {
+	if err = safeConn.start(); err != nil {
 		safeConn.Close()
-		return nil, fmt.Errorf("Authentication with usenet server failed: %v\r\n", err)
+		return nil, err
 	}
 	return &safeConn, nil
 }
 
+// start reads the greeting of the server and logs in
+func (c *safeConn) start() error {
+	c.text = textproto.NewConn(idleReader{c})
+	c.lastRead.Store(time.Now().UnixNano())
+	// read the server greeting
+	if err := c.withDeadline(conf.DialTimeout, func() error {
+		_, _, err := c.text.ReadCodeLine(20)
+		return err
+	}); err != nil {
+		return fmt.Errorf("NNTP greeting from usenet server \"%v\" failed: %v\r\n", c.server, err)
+	}
+	if err := c.withDeadline(conf.AuthTimeout, func() error {
+		return c.Authenticate(c.server.NntpUser, c.server.NntpPass)
+	}); err != nil {
+		return fmt.Errorf("Authentication with usenet server \"%v\" failed: %v\r\n", c.server, err)
+	}
+	return nil
+}
+
+// withDeadline runs f with an absolute deadline of timeout on the connection
+func (c *safeConn) withDeadline(timeout Duration, f func() error) error {
+	if timeout > 0 {
+		c.netConn.SetDeadline(time.Now().Add(time.Duration(timeout)))
+		defer c.netConn.SetDeadline(time.Time{})
+	}
+	return f()
+}
+
+// cmd sends an NNTP command and reads the response line
+// expectCode is handled like in textproto.ReadCodeLine
+func (c *safeConn) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.text.ReadCodeLine(expectCode)
+}
+
+// Authenticate logs in to the NNTP server
+// the password is only sent if the server requires one
+func (c *safeConn) Authenticate(username, password string) error {
+	if username == "" {
+		return nil
+	}
+	code, _, err := c.cmd(2, "AUTHINFO USER %s", username)
+	if code/100 == 3 {
+		_, _, err = c.cmd(2, "AUTHINFO PASS %s", password)
+	}
+	return err
+}
+
+// Body reads the body of the article with the provided id
+// the complete body is read so the connection is ready for the next command
+func (c *safeConn) Body(id string) (io.Reader, error) {
+	c.busy.Store(true)
+	defer c.busy.Store(false)
+	c.lastRead.Store(time.Now().UnixNano())
+	if _, _, err := c.cmd(222, "BODY %s", id); err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(c.text.DotReader())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
+// Stat checks if the article with the provided id is available on the server
+func (c *safeConn) Stat(id string) (bool, error) {
+	var found bool
+	err := c.withDeadline(conf.ReadTimeout, func() error {
+		code, _, err := c.cmd(223, "STAT %s", id)
+		if code == 430 {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return found, err
+}
+
+// stalledFor returns how long the connection has been waiting for data from the server
+func (c *safeConn) stalledFor() time.Duration {
+	if !c.busy.Load() {
+		return 0
+	}
+	return time.Since(time.Unix(0, c.lastRead.Load()))
+}
+
 func (c *safeConn) Close() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if !c.closed {
-		if c.Conn != nil {
-			c.Quit()
+		if c.text != nil {
+			c.withDeadline(conf.ReadTimeout, func() error {
+				_, err := c.text.Cmd("QUIT")
+				return err
+			})
+			c.text.Close()
+		} else if c.netConn != nil {
+			c.netConn.Close()
 		}
-		if len(connectionGuard) > 0 {
-			<-connectionGuard
+		if len(c.server.guard) > 0 {
+			<-c.server.guard
 		}
 		c.closed = true
 	}
 }
+
+// isProtocolError returns true if err is an error response of the usenet server
+// in this case the connection is still usable
+func isProtocolError(err error) bool {
+	var protocolError *textproto.Error
+	return errors.As(err, &protocolError)
+}
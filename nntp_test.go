@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNNTP is the server side of a connection to a usenet server
+// every command line is recorded and answered by the handler
+type fakeNNTP struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+// list returns the command lines received so far
+func (f *fakeNNTP) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// newFakeConn returns a connection to a fake server that sends the greeting
+// and answers every command with the response returned by the handler (raw text, lines ending with "\r\n")
+func newFakeConn(t *testing.T, server *Server, greeting string, handler func(command string, w io.Writer)) (*safeConn, *fakeNNTP) {
+	t.Helper()
+	client, serverSide := net.Pipe()
+	fake := &fakeNNTP{}
+	go func() {
+		defer serverSide.Close()
+		io.WriteString(serverSide, greeting)
+		reader := textproto.NewReader(bufio.NewReader(serverSide))
+		for {
+			line, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			fake.mu.Lock()
+			fake.commands = append(fake.commands, line)
+			fake.mu.Unlock()
+			if line == "QUIT" {
+				io.WriteString(serverSide, "205 bye\r\n")
+				return
+			}
+			handler(line, serverSide)
+		}
+	}()
+	if server.guard == nil {
+		server.guard = make(chan struct{}, 1)
+	}
+	conn := &safeConn{server: server, netConn: client}
+	t.Cleanup(conn.Close)
+	return conn, fake
+}
+
+// withConf changes the configuration for the test
+func withConf(t *testing.T, change func()) {
+	t.Helper()
+	saved := conf
+	t.Cleanup(func() { conf = saved })
+	change()
+}
+
+func TestAuthenticate(t *testing.T) {
+	withConf(t, func() { conf.ReadTimeout = Duration(time.Second) })
+	tests := []struct {
+		name     string
+		user     string
+		replies  map[string]string
+		commands []string
+		wantErr  bool
+	}{
+		{
+			name:     "no user",
+			commands: nil,
+		},
+		{
+			name:     "user and password",
+			user:     "user",
+			replies:  map[string]string{"AUTHINFO USER user": "381 password required\r\n", "AUTHINFO PASS secret": "281 ok\r\n"},
+			commands: []string{"AUTHINFO USER user", "AUTHINFO PASS secret"},
+		},
+		{
+			name:     "user only",
+			user:     "user",
+			replies:  map[string]string{"AUTHINFO USER user": "281 ok\r\n"},
+			commands: []string{"AUTHINFO USER user"},
+		},
+		{
+			name:     "wrong password",
+			user:     "user",
+			replies:  map[string]string{"AUTHINFO USER user": "381 password required\r\n", "AUTHINFO PASS secret": "481 rejected\r\n"},
+			commands: []string{"AUTHINFO USER user", "AUTHINFO PASS secret"},
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &Server{Host: "fake", NntpUser: test.user, NntpPass: "secret"}
+			conn, fake := newFakeConn(t, server, "200 welcome\r\n", func(command string, w io.Writer) {
+				io.WriteString(w, test.replies[command])
+			})
+			err := conn.start()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("start() error = %v, want error %v", err, test.wantErr)
+			}
+			if got := fake.list(); strings.Join(got, "|") != strings.Join(test.commands, "|") {
+				t.Errorf("commands = %q, want %q", got, test.commands)
+			}
+		})
+	}
+}
+
+func TestGreetingRejected(t *testing.T) {
+	withConf(t, func() { conf.ReadTimeout = Duration(time.Second) })
+	conn, _ := newFakeConn(t, &Server{Host: "fake"}, "502 access denied\r\n", func(string, io.Writer) {})
+	if err := conn.start(); err == nil || !strings.Contains(err.Error(), "greeting") {
+		t.Errorf("start() error = %v, want greeting error", err)
+	}
+}
+
+func TestBody(t *testing.T) {
+	withConf(t, func() { conf.ReadTimeout = Duration(time.Second) })
+	conn, fake := newFakeConn(t, &Server{Host: "fake"}, "200 welcome\r\n", func(command string, w io.Writer) {
+		switch command {
+		case "BODY <found@test>":
+			io.WriteString(w, "222 0 <found@test>\r\nline 1\r\n..dot line\r\n.\r\n")
+		default:
+			io.WriteString(w, "430 no such article\r\n")
+		}
+	})
+	if err := conn.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := conn.Body("<found@test>")
+	if err != nil {
+		t.Fatalf("Body() error = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	if want := "line 1\n.dot line\n"; string(data) != want {
+		t.Errorf("Body() = %q, want %q", data, want)
+	}
+
+	// a missing article does not break the connection
+	if _, err = conn.Body("<missing@test>"); !isProtocolError(err) {
+		t.Errorf("Body() of a missing article error = %v, want protocol error", err)
+	}
+	if _, err = conn.Body("<found@test>"); err != nil {
+		t.Errorf("Body() after a missing article error = %v", err)
+	}
+
+	want := []string{"BODY <found@test>", "BODY <missing@test>", "BODY <found@test>"}
+	if got := fake.list(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestStat(t *testing.T) {
+	withConf(t, func() { conf.ReadTimeout = Duration(time.Second) })
+	conn, fake := newFakeConn(t, &Server{Host: "fake"}, "200 welcome\r\n", func(command string, w io.Writer) {
+		switch command {
+		case "STAT <found@test>":
+			io.WriteString(w, "223 0 <found@test>\r\n")
+		case "STAT <missing@test>":
+			io.WriteString(w, "430 no such article\r\n")
+		default:
+			io.WriteString(w, "501 syntax error\r\n")
+		}
+	})
+	if err := conn.start(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id      string
+		found   bool
+		wantErr bool
+	}{
+		{"<found@test>", true, false},
+		{"<missing@test>", false, false},
+		{"found@test", false, true},
+	}
+	for _, test := range tests {
+		found, err := conn.Stat(test.id)
+		if found != test.found || (err != nil) != test.wantErr {
+			t.Errorf("Stat(%q) = %v, %v, want %v, error %v", test.id, found, err, test.found, test.wantErr)
+		}
+	}
+	if got := fake.list(); len(got) != len(tests) {
+		t.Errorf("commands = %q, want %d STAT commands", got, len(tests))
+	}
+}
+
+func TestBodyReadTimeout(t *testing.T) {
+	withConf(t, func() { conf.ReadTimeout = Duration(200 * time.Millisecond) })
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	conn, _ := newFakeConn(t, &Server{Host: "fake"}, "200 welcome\r\n", func(command string, w io.Writer) {
+		io.WriteString(w, "222 0 article\r\n")
+		switch command {
+		case "BODY <slow@test>":
+			// the body takes longer than the read timeout but data arrives within the timeout
+			for i := 0; i < 5; i++ {
+				time.Sleep(80 * time.Millisecond)
+				io.WriteString(w, "data\r\n")
+			}
+			io.WriteString(w, ".\r\n")
+		case "BODY <stalled@test>":
+			// the server stops sending data
+			io.WriteString(w, "data\r\n")
+			<-release
+		}
+	})
+	if err := conn.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Body("<slow@test>"); err != nil {
+		t.Fatalf("Body() of a slow article error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for conn.stalledFor() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	start := time.Now()
+	_, err := conn.Body("<stalled@test>")
+	<-done
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Body() of a stalled article error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Body() of a stalled article returned after %v", elapsed)
+	}
+	// the connection is broken, so the reader reconnects instead of reusing it
+	if isProtocolError(err) {
+		t.Errorf("timeout reported as protocol error")
+	}
+	if conn.stalledFor() != 0 {
+		t.Errorf("connection still reported as busy after the timeout")
+	}
+}
+
+func TestFailedArticleRequeued(t *testing.T) {
+	saved := articlesChan
+	articlesChan = make(chan Article, 1)
+	t.Cleanup(func() { articlesChan = saved })
+
+	article := Article{id: "requeue@test", retries: 1, partType: "data", index: 1}
+	failedArticlesChan <- article
+	select {
+	case got := <-articlesChan:
+		if got != article {
+			t.Errorf("requeued article = %+v, want %+v", got, article)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("article was not requeued")
+	}
+}
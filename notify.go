@@ -0,0 +1,11 @@
+package main
+
+// notify shows a desktop notification if the notifications are activated
+func notify(summary string, body string) {
+	if !conf.Notify {
+		return
+	}
+	if err := showNotification(summary, body); err != nil {
+		Log.Debug("Unable to show desktop notification: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// showNotification shows the notification in the notification center
+func showNotification(summary string, body string) error {
+	script := fmt.Sprintf("display notification %s with title %s subtitle %s", strconv.Quote(body), strconv.Quote(appName), strconv.Quote(summary))
+	return exec.Command("osascript", "-e", script).Run()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// showNotification sends the notification to org.freedesktop.Notifications on the D-Bus session bus
+func showNotification(summary string, body string) error {
+	if path, _ := exec.LookPath("gdbus"); path != "" {
+		output, err := exec.Command(path, "call", "--session",
+			"--dest", "org.freedesktop.Notifications",
+			"--object-path", "/org/freedesktop/Notifications",
+			"--method", "org.freedesktop.Notifications.Notify",
+			gvariantString(appName), "uint32 0", gvariantString(""), gvariantString(summary), gvariantString(body),
+			"@as []", "@a{sv} {}", "int32 -1",
+		).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	if path, _ := exec.LookPath("notify-send"); path != "" {
+		return exec.Command(path, "--app-name", appName, summary, body).Run()
+	}
+	return fmt.Errorf("neither gdbus nor notify-send found")
+}
+
+// gvariantString quotes the string in the GVariant text format used by gdbus
+func gvariantString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func showNotification(summary string, body string) error {
+	return errors.New("desktop notifications are not yet supported on your system")
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+// parameters of a NXGLNK URI
+//
+//	h          header (required)
+//	t          title
+//	p          password
+//	category   category of the download
+//	subfolder  subfolder of the destination path
+//	priority   priority in the download queue (low, normal, high)
+//	d          date the files were posted (YYYY-MM-DD, DD.MM.YYYY or Unix timestamp)
+//	g          newsgroup the files were posted to (can be repeated)
+//	profile    configuration profile
+var nxgLinkParams = []string{"h", "t", "p", "category", "subfolder", "priority", "d", "g", "profile"}
+
+// priorities of the downloads in the download queue
+var priorities = map[string]int{
+	"low":    -1,
+	"normal": 0,
+	"high":   1,
+}
+
+// exp to validate newsgroup names (e.g. alt.binaries.test)
+var newsgroupExp = regexp.MustCompile(`^[a-zA-Z0-9+_-]+(\.[a-zA-Z0-9+_-]+)*$`)
+
+// content of a NXGLNK URI
+type nxgLink struct {
+	Header     string
+	Title      string
+	Password   string
+	Category   string
+	Subfolder  string
+	Priority   string
+	PostDate   time.Time
+	Newsgroups []string
+	Profile    string
+}
+
+// parsed NXGLNK passed to the program
+var parsedLink nxgLink
+
+// parseNxgLink parses and validates the NXGLNK URI
+func parseNxgLink(uri string) (nxgLink, error) {
+	var link nxgLink
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return link, fmt.Errorf("invalid NXGLNK URI: %v", err)
+	}
+	if !strings.EqualFold(u.Scheme, "nxglnk") {
+		return link, fmt.Errorf("invalid NXGLNK URI: scheme must be 'nxglnk' but is '%v'", u.Scheme)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return link, fmt.Errorf("invalid NXGLNK URI: %v", err)
+	}
+	for key := range query {
+		if !slices.Contains(nxgLinkParams, key) {
+			Log.Debug("Ignoring unknown NXGLNK parameter '%v'", key)
+		}
+	}
+
+	if link.Header = strings.TrimSpace(query.Get("h")); link.Header == "" {
+		return link, fmt.Errorf("invalid NXGLNK URI: missing 'h' parameter")
+	}
+	link.Title = strings.TrimSpace(query.Get("t"))
+	link.Password = strings.TrimSpace(query.Get("p"))
+	link.Category = strings.TrimSpace(query.Get("category"))
+	link.Profile = strings.TrimSpace(query.Get("profile"))
+	if link.Subfolder = strings.TrimSpace(query.Get("subfolder")); link.Subfolder != "" {
+		if err = checkSubfolder(link.Subfolder); err != nil {
+			return link, fmt.Errorf("invalid NXGLNK URI: 'subfolder' parameter: %v", err)
+		}
+	}
+	if priority := strings.TrimSpace(query.Get("priority")); priority != "" {
+		if link.Priority, err = parsePriority(priority); err != nil {
+			return link, fmt.Errorf("invalid NXGLNK URI: 'priority' parameter: %v", err)
+		}
+	}
+	if date := strings.TrimSpace(query.Get("d")); date != "" {
+		if link.PostDate, err = parsePostDate(date); err != nil {
+			return link, fmt.Errorf("invalid NXGLNK URI: 'd' parameter: %v", err)
+		}
+	}
+	for _, group := range query["g"] {
+		if group = strings.TrimSpace(group); !newsgroupExp.MatchString(group) {
+			return link, fmt.Errorf("invalid NXGLNK URI: 'g' parameter: \"%v\" is not a valid newsgroup", group)
+		}
+		link.Newsgroups = append(link.Newsgroups, group)
+	}
+	return link, nil
+}
+
+// String returns the NXGLNK URI with the parameters in a fixed order
+func (l nxgLink) String() string {
+	var params []string
+	add := func(key string, value string) {
+		if value != "" {
+			params = append(params, key+"="+url.QueryEscape(value))
+		}
+	}
+	add("h", l.Header)
+	add("t", l.Title)
+	add("p", l.Password)
+	add("category", l.Category)
+	add("subfolder", filepath.ToSlash(l.Subfolder))
+	add("priority", l.Priority)
+	if !l.PostDate.IsZero() {
+		add("d", l.PostDate.Format(time.DateOnly))
+	}
+	for _, group := range l.Newsgroups {
+		add("g", group)
+	}
+	add("profile", l.Profile)
+	return "nxglnk://?" + strings.Join(params, "&")
+}
+
+// parsePriority returns the name of the priority (low, normal, high or -1, 0, 1)
+func parsePriority(priority string) (string, error) {
+	priority = strings.ToLower(strings.TrimSpace(priority))
+	if _, ok := priorities[priority]; ok {
+		return priority, nil
+	}
+	if value, err := strconv.Atoi(priority); err == nil {
+		for name, v := range priorities {
+			if v == value {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("\"%v\" is not a valid priority (low, normal, high)", priority)
+}
+
+// parsePostDate accepts dates as YYYY-MM-DD, DD.MM.YYYY or Unix timestamp
+func parsePostDate(date string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "02.01.2006"} {
+		if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if timestamp, err := strconv.ParseInt(date, 10, 64); err == nil && timestamp > 0 {
+		return time.Unix(timestamp, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("\"%v\" is not a valid date (YYYY-MM-DD, DD.MM.YYYY or Unix timestamp)", date)
+}
+
+// checkSubfolder makes sure the subfolder stays within the destination path
+func checkSubfolder(subfolder string) error {
+	path := filepath.FromSlash(subfolder)
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(path, string(filepath.Separator)) {
+		return fmt.Errorf("\"%v\" must be a relative path", subfolder)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == ".." {
+			return fmt.Errorf("\"%v\" must not contain '..'", subfolder)
+		}
+		if strings.ContainsAny(element, `:*?"<>|`) {
+			return fmt.Errorf("\"%v\" contains invalid characters", subfolder)
+		}
+	}
+	return nil
+}
+
+// runLinkCommand prints the NXGLNK (and its QR code) for the settings passed as arguments
+func runLinkCommand() {
+	if configSources["Header"] != "flag" || conf.Header == "" {
+		writeUsage(argParser)
+		Log.Error("You must provide the --header argument")
+		os.Exit(exitInvalidInput)
+	}
+	// only settings passed as arguments are part of the NXGLNK
+	link := nxgLink{Newsgroups: commands.Link.Groups}
+	for key, value := range map[string]*string{
+		"Header":    &link.Header,
+		"Title":     &link.Title,
+		"Password":  &link.Password,
+		"Category":  &link.Category,
+		"Subfolder": &link.Subfolder,
+		"Priority":  &link.Priority,
+		"Profile":   &link.Profile,
+	} {
+		if configSources[key] == "flag" {
+			*value = strings.TrimSpace(reflect.ValueOf(conf).FieldByName(key).String())
+		}
+	}
+	if commands.Link.Date != "" {
+		if link.PostDate, err = parsePostDate(commands.Link.Date); err != nil {
+			Log.Error("Invalid --date: %v", err)
+			os.Exit(exitInvalidInput)
+		}
+	}
+	if link.Priority != "" {
+		if link.Priority, err = parsePriority(link.Priority); err != nil {
+			Log.Error("Invalid --priority: %v", err)
+			os.Exit(exitInvalidInput)
+		}
+	}
+	if link.Subfolder != "" {
+		if err := checkSubfolder(link.Subfolder); err != nil {
+			Log.Error("Invalid --subfolder: %v", err)
+			os.Exit(exitInvalidInput)
+		}
+	}
+	for _, group := range link.Newsgroups {
+		if !newsgroupExp.MatchString(group) {
+			Log.Error("Invalid --group: \"%v\" is not a valid newsgroup", group)
+			os.Exit(exitInvalidInput)
+		}
+	}
+	// the NXGLNK must be valid for the download
+	uri := link.String()
+	if _, err := parseNxgLink(uri); err != nil {
+		Log.Error(err.Error())
+		os.Exit(exitInvalidInput)
+	}
+	fmt.Println(uri)
+	if !commands.Link.NoQR {
+		if err := printQRCode(os.Stdout, uri); err != nil {
+			Log.Warn("Unable to create the QR code: %v", err)
+		}
+	}
+	os.Exit(0)
+}
+
+// printQRCode writes the QR code of the text to the terminal
+// two modules are combined into one character with half blocks, the light modules
+// are printed as blocks so the code can be scanned on terminals with dark background
+func printQRCode(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.L)
+	if err != nil {
+		return err
+	}
+	const quietZone = 2
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return true
+		}
+		return !code.Black(x, y)
+	}
+	var b strings.Builder
+	for y := -quietZone; y < code.Size+quietZone; y += 2 {
+		for x := -quietZone; x < code.Size+quietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
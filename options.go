@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// every setting is parsed the same way, no matter if it is set in the configuration file,
+// by environment variable or as argument:
+//
+//	bool      true|false, yes|no, on|off, 1|0 (arguments: --x, --x=false or --no-x)
+//	Duration  seconds (e.g. 30) or with unit (e.g. 500ms, 30s, 1m30s)
+//	Size      bytes (e.g. 1048576) or with unit (e.g. 10MB, 1.5GiB)
+//	lists     comma separated (environment variables) or repeated (arguments)
+
+// Duration is a time span that accepts plain numbers as seconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration \"%v\" (e.g. 30, 30s or 1m30s)", value)
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Size is a number of bytes that accepts decimal (KB, MB, ...) and binary (KiB, MiB, ...) units
+type Size int64
+
+var sizeUnits = []struct {
+	name  string
+	bytes int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+}
+
+func (s *Size) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	number, multiplier := value, int64(1)
+	for _, unit := range sizeUnits {
+		if len(value) > len(unit.name) && strings.EqualFold(value[len(value)-len(unit.name):], unit.name) {
+			number, multiplier = strings.TrimSpace(value[:len(value)-len(unit.name)]), unit.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size*float64(multiplier) > math.MaxInt64 {
+		return fmt.Errorf("invalid size \"%v\" (e.g. 1048576, 10MB or 1.5GiB)", value)
+	}
+	*s = Size(size * float64(multiplier))
+	return nil
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Size) String() string {
+	for _, unit := range sizeUnits {
+		if s != 0 && unit.bytes > 1 && int64(s)%unit.bytes == 0 {
+			return fmt.Sprintf("%d%v", int64(s)/unit.bytes, unit.name)
+		}
+	}
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// parseBool parses the boolean values accepted for all settings
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value \"%v\" (must be true or false)", value)
+}
+
+// optionDecodeHook parses the values of the configuration file and the environment variables
+func optionDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to.Kind() == reflect.Bool && from.Kind() == reflect.String {
+		return parseBool(data.(string))
+	}
+	if unmarshaler, ok := reflect.New(to).Interface().(encoding.TextUnmarshaler); ok {
+		switch from.Kind() {
+		case reflect.String, reflect.Int, reflect.Int64, reflect.Float64:
+			if err := unmarshaler.UnmarshalText([]byte(fmt.Sprintf("%v", data))); err != nil {
+				return nil, err
+			}
+			return reflect.ValueOf(unmarshaler).Elem().Interface(), nil
+		}
+	}
+	return data, nil
+}
+
+// decodeConfig decodes the merged settings into the configuration
+func decodeConfig(conf *Args) error {
+	return viper.Unmarshal(conf, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		optionDecodeHook,
+		mapstructure.StringToSliceHookFunc(","),
+	)))
+}
+
+// normalizeArgs rewrites the boolean arguments so that all forms are accepted:
+// "--x", "--x=VALUE", "--x VALUE" and "--no-x"
+func normalizeArgs(args []string) ([]string, error) {
+	boolFlags := make(map[string]bool)
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		if field.value.Kind() == reflect.Bool {
+			for _, flag := range field.flags {
+				boolFlags[flag] = true
+			}
+		}
+	}
+	var normalized []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			normalized = append(normalized, args[i:]...)
+			break
+		}
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if name, ok := strings.CutPrefix(flag, "--no-"); ok && boolFlags["--"+name] {
+			if hasValue {
+				return nil, fmt.Errorf("%v does not take a value", flag)
+			}
+			normalized = append(normalized, "--"+name+"=false")
+			continue
+		}
+		if !boolFlags[flag] {
+			normalized = append(normalized, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			// the value may also be passed as separate argument
+			if _, err := parseBool(args[i+1]); err == nil {
+				value, hasValue = args[i+1], true
+				i++
+			}
+		}
+		if !hasValue {
+			normalized = append(normalized, flag)
+			continue
+		}
+		b, err := parseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", flag, err)
+		}
+		normalized = append(normalized, flag+"="+strconv.FormatBool(b))
+	}
+	return normalized, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chrisfarms/yenc"
+)
+
+// orders the articles are loaded in
+const (
+	orderSequential = "sequential" // in the order of the header
+	orderEdges      = "edges"      // the first and the last article of every file first
+)
+
+var articleOrders = []string{orderSequential, orderEdges}
+
+// articles of a file of the download
+type fileRange struct {
+	name  string
+	first int
+	last  int
+}
+
+// files of the download by part type
+// the files of the articles are only known after one of their articles was loaded:
+// the yEnc part number and sizes of an article tell which articles belong to its file,
+// so the last article before a known file is the last article of the previous file
+type fileRanges struct {
+	mu    sync.Mutex
+	files map[string][]fileRange // sorted by the first article
+}
+
+// learn adds the file of the loaded article
+func (f *fileRanges) learn(partType string, index int, part *yenc.Part, fileSize int64) {
+	if index == 0 || fileSize == 0 {
+		return
+	}
+	number := max(part.Number, 1)
+	partSize := articleSize(part)
+	first := index - number + 1
+	last := first + partsOf(fileSize, partSize) - 1
+	if partSize <= 0 || first < 1 || last > totalParts[partType] || last < index {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.files == nil {
+		f.files = make(map[string][]fileRange)
+	}
+	files := f.files[partType]
+	for _, file := range files {
+		if file.name == part.Name {
+			return
+		}
+	}
+	files = append(files, fileRange{name: part.Name, first: first, last: last})
+	sort.Slice(files, func(i, j int) bool { return files[i].first < files[j].first })
+	f.files[partType] = files
+	Log.Debug("File \"%v\": articles %d to %d", part.Name, first, last)
+}
+
+// articleSize returns the size of the articles of the file of the part
+// all articles of a file but the last one have the same size
+func articleSize(part *yenc.Part) int64 {
+	if part.Number > 1 {
+		return (part.Begin - 1) / int64(part.Number-1)
+	}
+	return part.End - part.Begin + 1
+}
+
+// list returns the known files of the part type
+func (f *fileRanges) list(partType string) []fileRange {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.files[partType])
+}
+
+func (f *fileRanges) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = nil
+}
+
+var knownFiles fileRanges
+
+// articleScheduler selects the article to load next
+type articleScheduler struct {
+	mu       sync.Mutex
+	partType string
+	total    int
+	queued   []bool // articles queued (or not to be loaded), index 1 to total
+	next     int    // lowest article that may not be queued yet
+	discover bool   // find the files of the download first
+	edges    bool   // load the first and the last article of every file first
+	priority []string
+}
+
+var scheduler *articleScheduler
+
+// newArticleScheduler creates the scheduler for the articles of the part type
+// only the indices are loaded (all if nil), articles already loaded by this download are skipped
+func newArticleScheduler(partType string, indices []int) *articleScheduler {
+	total := totalParts[partType]
+	s := &articleScheduler{
+		partType: partType,
+		total:    total,
+		queued:   make([]bool, total+1),
+		next:     1,
+		edges:    conf.ArticleOrder == orderEdges,
+	}
+	for _, pattern := range conf.PriorityFiles {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			s.priority = append(s.priority, strings.ToLower(pattern))
+		}
+	}
+	s.discover = s.edges || len(s.priority) > 0
+	if indices != nil {
+		for i := range s.queued {
+			s.queued[i] = true
+		}
+		for _, index := range indices {
+			if index >= 1 && index <= total {
+				s.queued[index] = false
+			}
+		}
+	}
+	for i := 1; i <= total; i++ {
+		if loadedArticles.contains(messageID(partType, i)) {
+			s.queued[i] = true
+		}
+	}
+	return s
+}
+
+// count returns the number of articles to load
+func (s *articleScheduler) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for i := 1; i <= s.total; i++ {
+		if !s.queued[i] {
+			count++
+		}
+	}
+	return count
+}
+
+// pick returns the index of the article to load next, false if all articles are queued
+func (s *articleScheduler) pick() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.choose()
+	if index == 0 {
+		return 0, false
+	}
+	s.queued[index] = true
+	return index, true
+}
+
+// choose returns the index of the next article or 0, s.mu must be held
+func (s *articleScheduler) choose() int {
+	available := func(index int) bool {
+		return index >= 1 && index <= s.total && !s.queued[index]
+	}
+	files := knownFiles.list(s.partType)
+	if s.discover {
+		// the first and the last article of the download
+		for _, index := range []int{1, s.total} {
+			if available(index) {
+				return index
+			}
+		}
+		// articles of the prioritized files
+		for _, pattern := range s.priority {
+			for _, file := range files {
+				if match, _ := filepath.Match(pattern, strings.ToLower(file.name)); !match {
+					continue
+				}
+				for index := file.first; index <= file.last; index++ {
+					if available(index) {
+						return index
+					}
+				}
+			}
+		}
+		// the last article of the previous file of the first known file at the end of the download
+		if index := unknownEnd(files, s.total); available(index) {
+			return index
+		}
+	}
+	if s.edges {
+		for _, file := range files {
+			for _, index := range []int{file.first, file.last} {
+				if available(index) {
+					return index
+				}
+			}
+		}
+	}
+	for ; s.next <= s.total; s.next++ {
+		if available(s.next) {
+			return s.next
+		}
+	}
+	return 0
+}
+
+// unknownEnd returns the last article not belonging to the known files at the end of the articles
+func unknownEnd(files []fileRange, total int) int {
+	index := total
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].first <= index && files[i].last >= index {
+			index = files[i].first - 1
+		}
+	}
+	return index
+}
+
+// message ids of the articles loaded by the current download
+type articleSet struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (a *articleSet) add(messageID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ids == nil {
+		a.ids = make(map[string]bool)
+	}
+	a.ids[messageID] = true
+}
+
+func (a *articleSet) contains(messageID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ids[messageID]
+}
+
+func (a *articleSet) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ids = nil
+}
+
+var loadedArticles articleSet
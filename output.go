@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// formats of the output
+const (
+	outputText = "text"
+	outputJSON = "json" // newline-delimited JSON events on stdout
+)
+
+var outputFormats = []string{outputText, outputJSON}
+
+// exit codes
+const (
+	exitSuccess         = 0
+	exitFailed          = 1 // the download failed for another reason (e.g. not enough disk space)
+	exitInvalidInput    = 2 // invalid arguments, configuration, NXGLNK or header
+	exitConnectionError = 3 // no connection to the usenet servers
+	exitRepairFailed    = 4 // too many missing articles, no par2 files, repair disabled or the repair failed
+	exitExtractFailed   = 5 // the rar archives could not be extracted
+	exitRepaired        = 6 // success, the files had to be repaired
+)
+
+var (
+	stdoutIsTerminal = term.IsTerminal(int(os.Stdout.Fd()))
+	eventMu          sync.Mutex
+)
+
+func jsonOutput() bool {
+	return conf.Output == outputJSON
+}
+
+// interactive returns true if progress bars and countdowns can be shown on stdout
+func interactive() bool {
+	return stdoutIsTerminal && !jsonOutput() && !tuiActive()
+}
+
+// successful returns true if the exit code is the one of a successful download
+func successful(exitCode int) bool {
+	return exitCode == exitSuccess || exitCode == exitRepaired
+}
+
+// emitEvent writes the event as a line of JSON to stdout (only if the output format is json)
+func emitEvent(event string, fields map[string]interface{}) {
+	if !jsonOutput() {
+		return
+	}
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["event"] = event
+	fields["time"] = time.Now().Format(time.RFC3339)
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	os.Stdout.Write(append(line, '\n'))
+}
+
+// progressEvents emits the progress of the download every second until stop is closed
+func progressEvents(stop <-chan struct{}) {
+	if !jsonOutput() {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			done, total, _ := progress.snapshot()
+			name, _ := stage.get()
+			fields := map[string]interface{}{
+				"stage":   name,
+				"bytes":   done,
+				"total":   total,
+				"speed":   speedMeter.speed(3),
+				"missing": missingArticles.len(),
+			}
+			if total > 0 {
+				fields["percent"] = done * 100 / total
+			}
+			emitEvent("progress", fields)
+		}
+	}
+}
+
+// emitResult emits the result of a download
+func emitResult(exitCode int, err error) {
+	result := batchResultCompleted
+	switch {
+	case exitCode == exitRepaired:
+		result = batchResultRepaired
+	case !successful(exitCode):
+		result = batchResultFailed
+	}
+	fields := map[string]interface{}{
+		"result":      result,
+		"exitCode":    exitCode,
+		"title":       conf.Title,
+		"header":      conf.Header,
+		"destination": conf.DestPath,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	emitEvent("result", fields)
+}
+
+// error with the exit code of the program
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code, err}
+}
+
+// exitCodeOf returns the exit code of the error
+func exitCodeOf(err error) int {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if err == nil {
+		return exitSuccess
+	}
+	return exitFailed
+}
@@ -18,6 +18,7 @@ import (
 func par2() error {
 
 	Log.Info("Starting repair process")
+	stage.set("Repairing files")
 
 	var (
 		par2ExitCodes  map[int]string
@@ -54,6 +55,9 @@ func par2() error {
 	}); err != nil {
 		checkForFatalErr(err)
 	}
+	if par2FileName == "" {
+		return fmt.Errorf("No par2 file found in \"%v\"", conf.TempPath)
+	}
 
 	// set parameters
 	parameters = append(parameters, "r", "-q")
@@ -64,7 +68,7 @@ func par2() error {
 
 	cmd := exec.Command(conf.Par2Exe, parameters...)
 	Log.Debug("Par command: %s", cmd.String())
-	if conf.Debug || conf.Verbose > 0 {
+	if conf.Debug || conf.Verbose > 0 || tuiActive() {
 		// create a pipe for the output of the program
 		if cmdReader, err = cmd.StdoutPipe(); err != nil {
 			return err
@@ -80,6 +84,7 @@ func par2() error {
 					progressbar.OptionThrottle(time.Millisecond*100),
 					progressbar.OptionShowElapsedTimeOnFinish(),
 					progressbar.OptionOnCompletion(newline),
+					progressbar.OptionSetWriter(barWriter()),
 				)
 			}
 
@@ -88,11 +93,12 @@ func par2() error {
 				if output != "" && !strings.Contains(output, "%") {
 					Log.Debug("PAR: %v", output)
 				}
-				if conf.Verbose > 0 {
-					exp := regexp.MustCompile(`(\d+)\.?\d*%`)
-					if output != "" && exp.MatchString(output) {
-						percentStr := exp.FindStringSubmatch(output)
-						percentInt, _ := strconv.Atoi(percentStr[1])
+				exp := regexp.MustCompile(`(\d+)\.?\d*%`)
+				if output != "" && exp.MatchString(output) {
+					percentStr := exp.FindStringSubmatch(output)
+					percentInt, _ := strconv.Atoi(percentStr[1])
+					stage.setPercent(percentInt)
+					if parProgressBar != nil {
 						parProgressBar.Set(percentInt)
 					}
 				}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// par2 packets used to verify the data files while they are downloaded
+// (see the Parity Volume Set Specification 2.0)
+const par2PacketHeaderSize = 64
+
+var (
+	par2PacketMagic   = []byte("PAR2\x00PKT")
+	par2MainType      = []byte("PAR 2.0\x00Main\x00\x00\x00\x00")
+	par2FileDescType  = []byte("PAR 2.0\x00FileDesc")
+	par2SliceHashType = []byte("PAR 2.0\x00IFSC\x00\x00\x00\x00")
+)
+
+// files of a par2 recovery set with the checksums of their slices
+type par2Set struct {
+	sliceSize int64
+	files     map[string]*par2File // by name
+}
+
+// data file of a par2 recovery set and the result of its verification
+type par2File struct {
+	name      string
+	size      int64
+	sliceSize int64
+	slices    [][md5.Size]byte // MD5 of every slice (the last slice is padded with zeros)
+
+	mu      sync.Mutex
+	checked []bool // slices that were verified
+	damaged int    // slices with a wrong checksum
+}
+
+// readPar2Set reads the recovery set from the critical packets of a par2 file
+// every par2 file of a set contains the critical packets, damaged packets are skipped
+func readPar2Set(path string) (*par2Set, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		sliceSize int64
+		names     = make(map[[16]byte]string)
+		sizes     = make(map[[16]byte]int64)
+		hashes    = make(map[[16]byte][][md5.Size]byte)
+	)
+	header := make([]byte, par2PacketHeaderSize)
+	for {
+		if _, err = io.ReadFull(file, header); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(header[:8], par2PacketMagic) {
+			return nil, fmt.Errorf("invalid par2 packet header")
+		}
+		length := binary.LittleEndian.Uint64(header[8:16])
+		if length < par2PacketHeaderSize || length%4 != 0 {
+			return nil, fmt.Errorf("invalid par2 packet length %d", length)
+		}
+		packetType := header[48:64]
+		if !bytes.Equal(packetType, par2MainType) && !bytes.Equal(packetType, par2FileDescType) && !bytes.Equal(packetType, par2SliceHashType) {
+			// e.g. the recovery slices of the volume files
+			if _, err = file.Seek(int64(length-par2PacketHeaderSize), io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body := make([]byte, length-par2PacketHeaderSize)
+		if _, err = io.ReadFull(file, body); err != nil {
+			break
+		}
+		hash := md5.New()
+		hash.Write(header[32:])
+		hash.Write(body)
+		if !bytes.Equal(hash.Sum(nil), header[16:32]) {
+			Log.Debug("Skipping damaged par2 packet in \"%v\"", path)
+			continue
+		}
+		switch {
+		case bytes.Equal(packetType, par2MainType) && len(body) >= 12:
+			sliceSize = int64(binary.LittleEndian.Uint64(body[:8]))
+		case bytes.Equal(packetType, par2FileDescType) && len(body) >= 56:
+			id := [16]byte(body[:16])
+			sizes[id] = int64(binary.LittleEndian.Uint64(body[48:56]))
+			names[id] = strings.TrimRight(string(body[56:]), "\x00")
+		case bytes.Equal(packetType, par2SliceHashType) && len(body) >= 16:
+			id := [16]byte(body[:16])
+			var slices [][md5.Size]byte
+			for entry := body[16:]; len(entry) >= md5.Size+4; entry = entry[md5.Size+4:] {
+				slices = append(slices, [md5.Size]byte(entry[:md5.Size]))
+			}
+			hashes[id] = slices
+		}
+	}
+
+	if sliceSize <= 0 || sliceSize%4 != 0 {
+		return nil, fmt.Errorf("no valid main packet found")
+	}
+	set := &par2Set{sliceSize: sliceSize, files: make(map[string]*par2File)}
+	for id, name := range names {
+		slices, ok := hashes[id]
+		if !ok || len(slices) != partsOf(sizes[id], sliceSize) {
+			continue
+		}
+		set.files[name] = &par2File{name: name, size: sizes[id], sliceSize: sliceSize, slices: slices, checked: make([]bool, len(slices))}
+	}
+	if len(set.files) == 0 {
+		return nil, fmt.Errorf("no file checksums found")
+	}
+	return set, nil
+}
+
+// par2 recovery set of the current download, nil if the par2 index file was not loaded first
+var (
+	par2IndexMu sync.Mutex
+	par2Index   *par2Set
+)
+
+func setPar2Index(set *par2Set) {
+	par2IndexMu.Lock()
+	defer par2IndexMu.Unlock()
+	par2Index = set
+}
+
+// par2IndexFile returns the file of the recovery set with the name, nil if it is unknown
+func par2IndexFile(name string) *par2File {
+	par2IndexMu.Lock()
+	defer par2IndexMu.Unlock()
+	if par2Index == nil {
+		return nil
+	}
+	return par2Index.files[name]
+}
+
+// verifySlices verifies the slices of the data file between begin and end (exclusive)
+// that were written completely, so damaged files are known before the download completed
+func verifySlices(file io.ReaderAt, name string, begin int64, end int64) {
+	par2File := par2IndexFile(name)
+	if par2File == nil {
+		return
+	}
+	coverage := coverageOf(name)
+	sliceSize := par2File.sliceSize
+	var buf []byte
+
+	par2File.mu.Lock()
+	defer par2File.mu.Unlock()
+	checked := false
+	for slice := begin / sliceSize; slice < int64(len(par2File.slices)) && slice*sliceSize < end; slice++ {
+		sliceBegin, sliceEnd := slice*sliceSize, min((slice+1)*sliceSize, par2File.size)
+		if par2File.checked[slice] || !coverage.covers(sliceBegin, sliceEnd) {
+			continue
+		}
+		par2File.checked[slice] = true
+		checked = true
+		if buf == nil {
+			buf = make([]byte, sliceSize)
+		}
+		clear(buf)
+		if _, err := file.ReadAt(buf[:sliceEnd-sliceBegin], sliceBegin); err != nil {
+			Log.Debug("Unable to read slice %d of \"%v\": %v", slice+1, name, err)
+			par2File.damaged++
+			continue
+		}
+		if md5.Sum(buf) != par2File.slices[slice] {
+			Log.Warn("Slice %d of \"%v\" (bytes %d-%d) is damaged", slice+1, name, sliceBegin, sliceEnd-1)
+			par2File.damaged++
+		}
+	}
+	if checked && par2File.damaged == 0 && allChecked(par2File.checked) {
+		Log.Debug("File \"%v\" verified", name)
+	}
+}
+
+// allChecked returns true if all slices were checked
+func allChecked(checked []bool) bool {
+	for _, ok := range checked {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verifiedFiles returns the number of data files of the recovery set, the number of files that were verified completely
+// and the files with damaged slices
+func verifiedFiles() (int, int, []string) {
+	par2IndexMu.Lock()
+	defer par2IndexMu.Unlock()
+	if par2Index == nil {
+		return 0, 0, nil
+	}
+	var (
+		verified int
+		damaged  []string
+	)
+	for name, file := range par2Index.files {
+		file.mu.Lock()
+		switch {
+		case file.damaged > 0:
+			damaged = append(damaged, name)
+		case allChecked(file.checked):
+			verified++
+		}
+		file.mu.Unlock()
+	}
+	sort.Strings(damaged)
+	return len(par2Index.files), verified, damaged
+}
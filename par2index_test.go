@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// par2Packet returns a par2 packet of the type with the body
+func par2Packet(setID []byte, packetType []byte, body []byte) []byte {
+	hash := md5.New()
+	hash.Write(setID)
+	hash.Write(packetType)
+	hash.Write(body)
+	packet := append([]byte(nil), par2PacketMagic...)
+	packet = binary.LittleEndian.AppendUint64(packet, uint64(par2PacketHeaderSize+len(body)))
+	packet = append(packet, hash.Sum(nil)...)
+	packet = append(packet, setID...)
+	packet = append(packet, packetType...)
+	return append(packet, body...)
+}
+
+// writePar2Set writes a par2 file with the critical packets of the files and a recovery slice
+func writePar2Set(t *testing.T, path string, sliceSize int, files map[string][]byte) {
+	t.Helper()
+	setID := bytes.Repeat([]byte{1}, 16)
+	main := binary.LittleEndian.AppendUint64(nil, uint64(sliceSize))
+	main = binary.LittleEndian.AppendUint32(main, uint32(len(files)))
+	var packets []byte
+	for name, data := range files {
+		id := md5.Sum([]byte(name))
+		main = append(main, id[:]...)
+		hash := md5.Sum(data)
+		desc := append(append(id[:], hash[:]...), hash[:]...)
+		desc = binary.LittleEndian.AppendUint64(desc, uint64(len(data)))
+		desc = append(desc, []byte(name)...)
+		desc = append(desc, make([]byte, (4-len(name)%4)%4)...)
+		packets = append(packets, par2Packet(setID, par2FileDescType, desc)...)
+		checksums := id[:]
+		for begin := 0; begin < len(data); begin += sliceSize {
+			slice := make([]byte, sliceSize)
+			copy(slice, data[begin:min(begin+sliceSize, len(data))])
+			hash := md5.Sum(slice)
+			checksums = append(checksums, hash[:]...)
+			checksums = binary.LittleEndian.AppendUint32(checksums, crc32.ChecksumIEEE(slice))
+		}
+		packets = append(packets, par2Packet(setID, par2SliceHashType, checksums)...)
+	}
+	recovery := par2Packet(setID, []byte("PAR 2.0\x00RecvSlic"), make([]byte, 4+sliceSize))
+	content := append(append(recovery, par2Packet(setID, par2MainType, main)...), packets...)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadPar2Set(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set.vol00+01.par2")
+	writePar2Set(t, path, 8, map[string][]byte{"a.bin": []byte("0123456789abcdefXYZ"), "b.bin": []byte("short")})
+	set, err := readPar2Set(path)
+	if err != nil {
+		t.Fatalf("readPar2Set() error = %v", err)
+	}
+	if set.sliceSize != 8 || len(set.files) != 2 {
+		t.Fatalf("readPar2Set() = slice size %d, %d files, want 8, 2", set.sliceSize, len(set.files))
+	}
+	if file := set.files["a.bin"]; file == nil || file.size != 19 || len(file.slices) != 3 {
+		t.Errorf("file \"a.bin\" = %+v, want 19 bytes in 3 slices", file)
+	}
+
+	// a damaged packet is skipped
+	content, _ := os.ReadFile(path)
+	content[len(content)-1] ^= 0xff
+	os.WriteFile(path, content, 0644)
+	if set, err = readPar2Set(path); err != nil || len(set.files) != 1 {
+		t.Errorf("readPar2Set() of a damaged file = %v, %v, want 1 file", set, err)
+	}
+
+	os.WriteFile(path, []byte("no par2 file"), 0644)
+	if _, err = readPar2Set(path); err == nil {
+		t.Errorf("readPar2Set() of an invalid file returned no error")
+	}
+}
+
+func TestVerifySlices(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("0123456789abcdefXYZ")
+	writePar2Set(t, filepath.Join(dir, "set.par2"), 8, map[string][]byte{"a.bin": data})
+	set, err := readPar2Set(filepath.Join(dir, "set.par2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPar2Index(set)
+	resetCoverage()
+	t.Cleanup(func() {
+		setPar2Index(nil)
+		resetCoverage()
+	})
+
+	// the second slice is damaged
+	written := bytes.Clone(data)
+	written[9] = '!'
+	file := bytes.NewReader(written)
+	write := func(begin int64, end int64) {
+		coverageOf("a.bin").add(begin, end)
+		verifySlices(file, "a.bin", begin, end)
+	}
+
+	write(0, 16)
+	if total, verified, damaged := verifiedFiles(); total != 1 || verified != 0 || !slices.Equal(damaged, []string{"a.bin"}) {
+		t.Errorf("verifiedFiles() = %d, %d, %q, want the damaged file", total, verified, damaged)
+	}
+	if checked := set.files["a.bin"].checked; !slices.Equal(checked, []bool{true, true, false}) {
+		t.Errorf("checked slices = %v, want the first two", checked)
+	}
+	// the last slice is shorter than the slice size
+	write(16, 19)
+	if checked := set.files["a.bin"].checked; !allChecked(checked) || set.files["a.bin"].damaged != 1 {
+		t.Errorf("checked slices = %v, damaged %d, want all slices checked and 1 damaged", checked, set.files["a.bin"].damaged)
+	}
+
+	// files without checksums are not verified
+	verifySlices(file, "other.bin", 0, 19)
+}
+
+func TestPar2Probes(t *testing.T) {
+	tests := []struct {
+		total int
+		count int
+		want  []int
+	}{
+		{1, 4, []int{1}},
+		{4, 8, []int{1, 2, 3, 4}},
+		{10, 1, []int{1, 10}},
+		{100, 4, []int{1, 34, 67, 100}},
+	}
+	for _, test := range tests {
+		if got := par2Probes(test.total, test.count); !slices.Equal(got, test.want) {
+			t.Errorf("par2Probes(%d, %d) = %v, want %v", test.total, test.count, got, test.want)
+		}
+	}
+}
+
+func TestSmallestPar2File(t *testing.T) {
+	volumes := []fileRange{{"set.vol00+01.par2", 1, 2}, {"set.vol01+02.par2", 3, 3}, {"set.vol03+04.par2", 4, 9}}
+	if file, ok := smallestPar2File(volumes); !ok || file.name != "set.vol01+02.par2" {
+		t.Errorf("smallestPar2File() = %v, %v, want the smallest volume", file, ok)
+	}
+	withIndex := append(volumes, fileRange{"set.par2", 10, 11})
+	if file, ok := smallestPar2File(withIndex); !ok || file.name != "set.par2" {
+		t.Errorf("smallestPar2File() = %v, %v, want the index file", file, ok)
+	}
+	if _, ok := smallestPar2File(nil); ok {
+		t.Errorf("smallestPar2File() of no files found a file")
+	}
+}
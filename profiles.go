@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// environment variable to select the profile
+const profileEnvVar = "NXG_PROFILE"
+
+// selectProfile returns the name of the profile to be used and where it was selected
+// precedence: argument, NXGLNK, environment variable, configuration file
+func selectProfile() (string, string) {
+	if configSources["Profile"] == "flag" {
+		return conf.Profile, "flag"
+	}
+	if conf.NxgLnk != "" {
+		if nxglnk, err := url.Parse(conf.NxgLnk); err == nil {
+			if profile := nxglnk.Query().Get("profile"); profile != "" {
+				return strings.TrimSpace(profile), "NXGLNK"
+			}
+		}
+	}
+	if profile := os.Getenv(profileEnvVar); profile != "" {
+		return profile, "environment variable " + profileEnvVar
+	}
+	return conf.Profile, configSources["Profile"]
+}
+
+// configuration profile
+type profile struct {
+	name     string
+	settings map[string]interface{}
+}
+
+// profileChain returns the profile and all profiles it inherits from,
+// starting with the base profile
+func profileChain(name string) ([]profile, error) {
+	var chain []profile
+	profiles := viper.GetStringMap("Profiles")
+	visited := make(map[string]bool)
+	for name != "" {
+		name = strings.ToLower(name)
+		if visited[name] {
+			return nil, fmt.Errorf("circular inheritance of profile \"%v\"", name)
+		}
+		visited[name] = true
+		settings, ok := profiles[name].(map[string]interface{})
+		if !ok {
+			if _, exists := profiles[name]; exists {
+				return nil, fmt.Errorf("profile \"%v\" is empty or not a list of settings", name)
+			}
+			return nil, fmt.Errorf("profile \"%v\" not found (available profiles: %v)", name, strings.Join(profileNames(), ", "))
+		}
+		chain = append([]profile{{name, settings}}, chain...)
+		name, _ = settings["inherit"].(string)
+	}
+	return chain, nil
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("Profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile merges the settings of the selected profile into the configuration
+// and parses the arguments again so they keep their precedence
+func applyProfile(args []string) error {
+	name, source := selectProfile()
+	if name == "" {
+		return nil
+	}
+	chain, err := profileChain(name)
+	if err != nil {
+		return err
+	}
+	// name of the profile each key was taken from
+	profileKeys := make(map[string]string)
+	for _, profile := range chain {
+		settings := make(map[string]interface{})
+		for key, value := range profile.settings {
+			if key != "inherit" {
+				settings[key] = value
+				profileKeys[key] = profile.name
+			}
+		}
+		if err = viper.MergeConfigMap(settings); err != nil {
+			return err
+		}
+	}
+	conf = Args{}
+	if err = decodeConfig(&conf); err != nil {
+		return fmt.Errorf("Unable to decode settings of profile \"%v\": %v", name, err)
+	}
+	conf.Profile = name
+	recordConfigSources()
+	for _, field := range configFields(reflect.ValueOf(&conf).Elem()) {
+		if _, ok := environmentSource(field.key); ok {
+			continue
+		}
+		if profileName, ok := profileKeys[strings.ToLower(field.key)]; ok {
+			configSources[field.key] = "profile " + profileName
+		}
+	}
+	configSources["Profile"] = source
+	if err = parseArgs(args); err != nil {
+		return err
+	}
+	recordArgumentSources(args)
+	Log.Debug("Using profile \"%v\" (selected by %v)", name, source)
+	return nil
+}
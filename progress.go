@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+const progressDescription = "INFO:    Downloading        "
+
+// progress of a file of the download
+type fileProgress struct {
+	name     string
+	size     int64 // size of the file from the yEnc header
+	parts    int   // number of articles of the file
+	loaded   int64 // bytes written
+	complete int   // articles written
+	missing  int   // articles that could not be loaded or written
+}
+
+// downloadProgress tracks the progress of the articles of a part type
+// the total size is the sum of the sizes of the files found in the yEnc headers,
+// the size of the files not found yet is estimated with the size of the articles
+type downloadProgress struct {
+	mu       sync.Mutex
+	bar      *progressbar.ProgressBar
+	partType string
+	articles int // number of articles to load
+	files    map[string]*fileProgress
+	partSize int64 // size of the largest article
+	done     int64 // bytes written plus the bytes of the missing articles of the known files
+	missing  int   // missing articles that could not be assigned to a file, their size is estimated
+}
+
+var progress downloadProgress
+
+// start resets the progress for the number of articles of the part type
+func (p *downloadProgress) start(partType string, articles int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bar = nil
+	if conf.Verbose > 0 {
+		// the total is unknown until the size of the first article is known
+		p.bar = progressbar.NewOptions64(math.MaxInt64,
+			progressbar.OptionSetDescription(progressDescription),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionSetRenderBlankState(true),
+			progressbar.OptionShowElapsedTimeOnFinish(),
+			progressbar.OptionOnCompletion(newline),
+			progressbar.OptionSetWriter(barWriter()),
+		)
+	}
+	p.partType = partType
+	p.articles = articles
+	p.files = make(map[string]*fileProgress)
+	p.partSize = 0
+	p.done = 0
+	p.missing = 0
+}
+
+// discover adds the file of an article with the sizes of the yEnc header
+func (p *downloadProgress) discover(name string, size int64, partSize int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if partSize > p.partSize {
+		p.partSize = partSize
+		// the number of articles of the files depends on the article size
+		for _, file := range p.files {
+			file.parts = partsOf(file.size, p.partSize)
+		}
+	}
+	if _, ok := p.files[name]; !ok && size > 0 {
+		p.files[name] = &fileProgress{name: name, size: size, parts: partsOf(size, p.partSize)}
+		Log.Debug("File \"%v\": %v", name, formatBytes(size))
+	}
+	p.update()
+}
+
+// written adds the bytes of an article written to the file
+func (p *downloadProgress) written(name string, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if file, ok := p.files[name]; ok {
+		file.loaded += bytes
+		file.complete++
+	}
+	p.done += bytes
+	p.update()
+}
+
+// missed counts a missing article, the file is empty if the article could not be decoded
+// bytes is the part of the article that was not written, the article size is assumed if it is unknown
+func (p *downloadProgress) missed(name string, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	file, ok := p.files[name]
+	if !ok {
+		p.missing++
+		p.update()
+		return
+	}
+	file.missing++
+	if bytes <= 0 {
+		bytes = p.partSize
+	}
+	p.done += bytes
+	p.update()
+}
+
+// total returns the size of the known files plus the estimated size of the articles of the other files
+func (p *downloadProgress) total() int64 {
+	var (
+		total int64
+		parts int
+	)
+	for _, file := range p.files {
+		total += file.size
+		parts += file.parts
+	}
+	if unknown := p.articles - parts; unknown > 0 {
+		total += int64(unknown) * p.partSize
+	}
+	return total
+}
+
+// update sets the total and the current value of the progress bar, p.mu must be held
+func (p *downloadProgress) update() {
+	if p.bar == nil || p.partSize == 0 {
+		return
+	}
+	total := p.total()
+	if total != p.bar.GetMax64() {
+		p.bar.ChangeMax64(total)
+	}
+	p.bar.Set64(min(p.done+int64(p.missing)*p.partSize, total))
+}
+
+// describe changes the description of the progress bar
+func (p *downloadProgress) describe(description string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar != nil {
+		p.bar.Describe(description)
+	}
+}
+
+// finish completes the progress bar and logs the progress of each file
+func (p *downloadProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+	var names []string
+	for name := range p.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		Log.Info("Downloaded %v files:", p.partType)
+	}
+	for _, name := range names {
+		file := p.files[name]
+		line := "  %v: %v of %v, %d of %d parts"
+		if file.missing > 0 {
+			Log.Info(line+", %d missing", file.name, formatBytes(file.loaded), formatBytes(file.size), file.complete, file.parts, file.missing)
+		} else {
+			Log.Info(line, file.name, formatBytes(file.loaded), formatBytes(file.size), file.complete, file.parts)
+		}
+	}
+	if p.missing > 0 {
+		Log.Info("  %d missing parts of unknown files", p.missing)
+	}
+}
+
+// snapshot returns the bytes done, the total size and the progress of the files ordered by name
+func (p *downloadProgress) snapshot() (int64, int64, []fileProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var files []fileProgress
+	for _, file := range p.files {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	total := p.total()
+	return min(p.done+int64(p.missing)*p.partSize, total), total, files
+}
+
+// partsOf returns the number of articles of a file
+func partsOf(size int64, partSize int64) int {
+	if partSize <= 0 {
+		return 0
+	}
+	return int((size + partSize - 1) / partSize)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// returned by the protocol functions on systems without support for registering the URL protocol
+var errProtocolNotSupported = errors.New("registering the URL protocol is not yet supported on your system")
+
+// registration of the NXGLNK scheme
+type protocolRegistration struct {
+	registered bool
+	location   string // where the protocol is registered (e.g. the desktop file)
+	command    string // command that is run for a NXGLNK
+	isDefault  bool   // true if the program is the default handler of the scheme
+}
+
+// runRegisterCommand registers the NXGLNK scheme or shows the status of the registration
+func runRegisterCommand() {
+	if commands.Register != nil && commands.Register.Status {
+		showProtocolStatus()
+	}
+	if err := registerProtocol(commands.Register != nil && commands.Register.Headless); errors.Is(err, errProtocolNotSupported) {
+		Log.Warn("Registering the URL protocol is not yet supported on your system.")
+		os.Exit(0)
+	} else if err != nil {
+		Log.Error("Unable to register 'nxglnk' URL protocol: %v", err)
+		os.Exit(1)
+	}
+	Log.Info("URL protocol 'nxglnk' successfuly registered to '%s'", appExec)
+	os.Exit(0)
+}
+
+// runUnregisterCommand removes the registration of the NXGLNK scheme
+func runUnregisterCommand() {
+	if err := unregisterProtocol(); errors.Is(err, errProtocolNotSupported) {
+		Log.Warn("Unregistering the URL protocol is not yet supported on your system.")
+		os.Exit(0)
+	} else if err != nil {
+		Log.Error("Unable to unregister 'nxglnk' URL protocol: %v", err)
+		os.Exit(1)
+	}
+	Log.Info("URL protocol 'nxglnk' successfuly unregistered")
+	os.Exit(0)
+}
+
+// showProtocolStatus shows the status of the registration
+// the exit code is 0 if the protocol is registered to this program
+func showProtocolStatus() {
+	status, err := protocolStatus()
+	if errors.Is(err, errProtocolNotSupported) {
+		Log.Warn("Registering the URL protocol is not yet supported on your system.")
+		os.Exit(1)
+	} else if err != nil {
+		Log.Error("Unable to determine the registration of the 'nxglnk' URL protocol: %v", err)
+		os.Exit(1)
+	}
+	if !status.registered {
+		Log.Info("URL protocol 'nxglnk' is not registered")
+		os.Exit(1)
+	}
+	Log.Info("URL protocol 'nxglnk' is registered in '%s'", status.location)
+	Log.Info("Command: %s", status.command)
+	exitCode := 0
+	if !strings.Contains(status.command, appExec) {
+		Log.Warn("The registered command does not run '%s'", appExec)
+		exitCode = 1
+	}
+	if !status.isDefault {
+		Log.Warn("%s is not the default handler of the 'nxglnk' URL protocol", appName)
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+}
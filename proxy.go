@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// environment variables checked (in this order) for a proxy if no proxy is configured for a server
+var proxyEnvVars = []string{"NXG_PROXY", "ALL_PROXY", "all_proxy"}
+
+// proxyURL returns the proxy to be used for the connections to the usenet server
+// or nil if the server is to be connected directly
+func proxyURL(server *Server) (*url.URL, error) {
+	rawURL := server.Proxy
+	source := "configuration"
+	if rawURL == "" {
+		for _, envVar := range proxyEnvVars {
+			if rawURL = os.Getenv(envVar); rawURL != "" {
+				source = "environment variable " + envVar
+				break
+			}
+		}
+		if rawURL != "" && noProxy(server.Host) {
+			return nil, nil
+		}
+	}
+	if rawURL == "" || rawURL == "none" || rawURL == "direct" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL in %v: %v", source, err)
+	}
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h", "http":
+	case "https":
+		return nil, fmt.Errorf("HTTPS proxies are not supported in %v (use http://, the connection to the usenet server is still encrypted if SSL is enabled)", source)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme \"%v\" in %v (must be socks5, socks5h or http)", proxyURL.Scheme, source)
+	}
+	if proxyURL.Port() == "" {
+		return nil, fmt.Errorf("no port provided for the proxy in %v", source)
+	}
+	return proxyURL, nil
+}
+
+// noProxy returns true if the host is excluded from using the proxy by the NO_PROXY environment variable
+func noProxy(host string) bool {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || entry == strings.ToLower(host) || strings.HasSuffix(strings.ToLower(host), "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialServer opens the TCP connection to the usenet server, using the proxy if one is configured
+func dialServer(server *Server) (net.Conn, error) {
+	ctx := context.Background()
+	if conf.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(conf.DialTimeout))
+		defer cancel()
+	}
+	dialer := &net.Dialer{}
+	if server.proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", server.address())
+	}
+	switch server.proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if server.proxyURL.User != nil {
+			password, _ := server.proxyURL.User.Password()
+			auth = &proxy.Auth{User: server.proxyURL.User.Username(), Password: password}
+		}
+		socksDialer, err := proxy.SOCKS5("tcp", server.proxyURL.Host, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := socksDialer.(proxy.ContextDialer).DialContext(ctx, "tcp", server.address())
+		if err != nil {
+			return nil, fmt.Errorf("SOCKS5 proxy \"%v\": %v", server.proxyURL.Host, err)
+		}
+		return conn, nil
+	case "http":
+		return dialHTTPConnect(ctx, dialer, server)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme \"%v\"", server.proxyURL.Scheme)
+	}
+}
+
+// dialHTTPConnect opens a tunnel to the usenet server using the HTTP CONNECT method
+func dialHTTPConnect(ctx context.Context, dialer *net.Dialer, server *Server) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, "tcp", server.proxyURL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP proxy \"%v\": %v", server.proxyURL.Host, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: server.address()},
+		Host:   server.address(),
+		Header: make(http.Header),
+	}
+	if server.proxyURL.User != nil {
+		password, _ := server.proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(server.proxyURL.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err = request.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy \"%v\": %v", server.proxyURL.Host, err)
+	}
+	// the size of the response header is limited, so a misbehaving proxy cannot send an endless header
+	limited := &io.LimitedReader{R: conn, N: maxProxyResponseSize}
+	reader := bufio.NewReader(limited)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		if limited.N <= 0 {
+			return nil, fmt.Errorf("HTTP proxy \"%v\": response header exceeds %v", server.proxyURL.Host, formatBytes(maxProxyResponseSize))
+		}
+		return nil, fmt.Errorf("HTTP proxy \"%v\": %v", server.proxyURL.Host, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy \"%v\" refused the connection: %v", server.proxyURL.Host, response.Status)
+	}
+	// the NNTP greeting may already have been read with the response header
+	buffered, _ := reader.Peek(reader.Buffered())
+	return &bufferedConn{conn, io.MultiReader(bytes.NewReader(buffered), conn)}, nil
+}
+
+// maximum size of the response header of the HTTP proxy
+const maxProxyResponseSize = 64 << 10
+
+// connection with data that was read in advance
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newFakeProxy starts an HTTP proxy that answers the CONNECT request with the response
+func newFakeProxy(t *testing.T, response string) *url.URL {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		io.WriteString(conn, response)
+	}()
+	return &url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	server := &Server{Host: "news.example.com", Port: 119}
+	// the greeting of the usenet server is sent together with the response of the proxy
+	server.proxyURL = newFakeProxy(t, "HTTP/1.1 200 Connection established\r\n\r\n200 welcome\r\n")
+	conn, err := dialServer(server)
+	if err != nil {
+		t.Fatalf("dialServer() error = %v", err)
+	}
+	defer conn.Close()
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || greeting != "200 welcome\r\n" {
+		t.Errorf("greeting = %q, %v, want %q", greeting, err, "200 welcome\r\n")
+	}
+}
+
+func TestHTTPConnectErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"refused", "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n", "refused the connection"},
+		{"header too large", "HTTP/1.1 200 OK\r\nX-Padding: " + strings.Repeat("x", maxProxyResponseSize) + "\r\n\r\n", "response header exceeds"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &Server{Host: "news.example.com", Port: 119}
+			server.proxyURL = newFakeProxy(t, test.response)
+			conn, err := dialServer(server)
+			if err == nil {
+				conn.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("dialServer() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestProxyURLScheme(t *testing.T) {
+	tests := []struct {
+		proxy   string
+		wantErr string
+	}{
+		{"http://proxy:3128", ""},
+		{"socks5://proxy:1080", ""},
+		{"https://proxy:3128", "HTTPS proxies are not supported"},
+		{"ftp://proxy:21", "unsupported proxy scheme"},
+	}
+	for _, test := range tests {
+		_, err := proxyURL(&Server{Host: "news.example.com", Proxy: test.proxy})
+		if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("proxyURL(%q) error = %v, want %q", test.proxy, err, test.wantErr)
+		}
+	}
+}
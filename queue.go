@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	queueFileName = "nxg-loader.queue"
+
+	// updated regularly by the serve command
+	serveHeartbeatFileName = "nxg-loader.serve"
+	serveHeartbeatInterval = 10 * time.Second
+
+	// status of a download in the queue
+	queueStatusQueued      = "queued"
+	queueStatusDownloading = "downloading"
+	queueStatusFailed      = "failed"
+
+	// ID of the queued download a process of the serve command is started for
+	queueItemEnvVar = "NXG_QUEUE_ITEM"
+)
+
+// download of the download queue
+type queueItem struct {
+	ID        int       `json:"id"`
+	NxgLnk    string    `json:"nxglnk,omitempty"`
+	Header    string    `json:"header,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Password  string    `json:"password,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Subfolder string    `json:"subfolder,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	Profile   string    `json:"profile,omitempty"`
+	Flags     []string  `json:"flags,omitempty"` // settings passed as arguments when the download was added
+	Added     time.Time `json:"added"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// download queue shared by the "queue" commands and the "serve" command
+type downloadQueue struct {
+	NextID int         `json:"nextId"`
+	Items  []queueItem `json:"items"`
+}
+
+func queueFilePath() string {
+	return filepath.Join(confFilePath, queueFileName)
+}
+
+// updateQueue runs f on the download queue and saves the changes
+// the queue file is locked meanwhile as several processes may use it
+func updateQueue(f func(queue *downloadQueue) error) error {
+	unlock, err := lockQueue()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	queue, err := readQueue()
+	if err != nil {
+		return err
+	}
+	if err = f(queue); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the queue contains the passwords of the downloads
+	return os.WriteFile(queueFilePath(), content, 0600)
+}
+
+func readQueue() (*downloadQueue, error) {
+	queue := &downloadQueue{NextID: 1}
+	content, err := os.ReadFile(queueFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return queue, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, queue); err != nil {
+		return nil, fmt.Errorf("queue file \"%v\" is corrupt: %v", queueFilePath(), err)
+	}
+	return queue, nil
+}
+
+// lockQueue creates the lock file of the queue and returns the function to remove it
+// lock files older than a minute are left over from a crashed process and are removed
+func lockQueue() (func(), error) {
+	lockFile := queueFilePath() + ".lock"
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(100 * time.Millisecond) {
+		file, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockFile) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockFile); err == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(lockFile)
+		}
+	}
+	return nil, fmt.Errorf("unable to lock the queue file \"%v\"", queueFilePath())
+}
+
+// runQueueCommand adds, lists or removes downloads of the download queue
+func runQueueCommand() {
+	switch {
+	case commands.Queue.Add != nil:
+		item, err := queueDownload()
+		if err != nil {
+			Log.Error("Unable to add the download to the queue: %v", err)
+			os.Exit(exitCodeOf(err))
+		}
+		Log.Info("Download %d added to the queue", item.ID)
+	case commands.Queue.List != nil:
+		queue, err := readQueue()
+		if err != nil {
+			Log.Error("Unable to read the queue: %v", err)
+			os.Exit(1)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tPRIORITY\tADDED\tTITLE")
+		for _, item := range queue.Items {
+			status := item.Status
+			if item.Error != "" {
+				status += " (" + item.Error + ")"
+			}
+			fmt.Fprintf(w, "%d\t%v\t%v\t%v\t%v\n", item.ID, status, item.priority(), item.Added.Format("2006-01-02 15:04"), item.name())
+		}
+		w.Flush()
+	case commands.Queue.Remove != nil:
+		if err := updateQueue(func(queue *downloadQueue) error {
+			for _, id := range commands.Queue.Remove.IDs {
+				index := queue.index(id)
+				if index < 0 {
+					return withExitCode(exitInvalidInput, fmt.Errorf("no download with the ID %d in the queue", id))
+				}
+				if queue.Items[index].Status == queueStatusDownloading {
+					return withExitCode(exitInvalidInput, fmt.Errorf("download %d is currently being downloaded", id))
+				}
+				queue.Items = append(queue.Items[:index], queue.Items[index+1:]...)
+			}
+			return nil
+		}); err != nil {
+			Log.Error("Unable to remove the download from the queue: %v", err)
+			os.Exit(exitCodeOf(err))
+		}
+		Log.Info("Download(s) removed from the queue")
+	default:
+		writeHelp(argParser)
+		os.Exit(exitInvalidInput)
+	}
+	os.Exit(0)
+}
+
+// queueDownload adds the NXGLNK (or the header, title and password) to the download queue
+func queueDownload() (queueItem, error) {
+	parseNxgLnk()
+	if conf.Header == "" {
+		return queueItem{}, withExitCode(exitInvalidInput, fmt.Errorf("You must provide either the --header argument or a NXGLNK URI"))
+	}
+	item := queueItem{
+		NxgLnk:    conf.NxgLnk,
+		Header:    conf.Header,
+		Title:     conf.Title,
+		Category:  conf.Category,
+		Subfolder: conf.Subfolder,
+		Priority:  conf.Priority,
+	}
+	// the password of the NXGLNK is not stored twice
+	if conf.NxgLnk == "" || configSources["Password"] == "flag" {
+		item.Password = conf.Password
+	}
+	// the profile is selected when the download is added, the profile of the serve command is used otherwise
+	if source := configSources["Profile"]; source == "flag" || source == "NXGLNK" {
+		item.Profile = conf.Profile
+	}
+	for _, key := range []string{"Title", "Password", "Category", "Subfolder"} {
+		if configSources[key] == "flag" {
+			item.Flags = append(item.Flags, key)
+		}
+	}
+	return enqueue(item)
+}
+
+// enqueue validates the download and adds it to the download queue
+func enqueue(item queueItem) (queueItem, error) {
+	if err := item.validate(); err != nil {
+		return item, withExitCode(exitInvalidInput, err)
+	}
+	items, err := enqueueAll([]queueItem{item})
+	if err != nil {
+		return item, err
+	}
+	return items[0], nil
+}
+
+// enqueueAll adds the validated downloads to the download queue, either all or none of them
+func enqueueAll(items []queueItem) ([]queueItem, error) {
+	items = slices.Clone(items)
+	err := updateQueue(func(queue *downloadQueue) error {
+		for i := range items {
+			items[i].ID = queue.NextID
+			items[i].Added = time.Now()
+			items[i].Status = queueStatusQueued
+			queue.NextID++
+			queue.Items = append(queue.Items, items[i])
+		}
+		return nil
+	})
+	return items, err
+}
+
+// validate checks the download and normalizes the header and the priority
+func (i *queueItem) validate() error {
+	h, err := parseHeader(i.Header)
+	if err != nil {
+		return fmt.Errorf("invalid header: %v", err)
+	}
+	if _, err = messageIDSchemeFor(h.Version); err != nil {
+		return fmt.Errorf("invalid header: %v", err)
+	}
+	i.Header = h.Encoded
+	if i.Priority != "" {
+		if i.Priority, err = parsePriority(i.Priority); err != nil {
+			return err
+		}
+	}
+	if i.Subfolder != "" {
+		if err = checkSubfolder(i.Subfolder); err != nil {
+			return fmt.Errorf("invalid subfolder: %v", err)
+		}
+	}
+	if i.Profile != "" {
+		if _, err = profileChain(i.Profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *downloadQueue) index(id int) int {
+	for i, item := range q.Items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (i queueItem) name() string {
+	if i.Title != "" {
+		return i.Title
+	}
+	if len(i.Header) > 40 {
+		return i.Header[:40] + "..."
+	}
+	return i.Header
+}
+
+func (i queueItem) priority() string {
+	if i.Priority == "" {
+		return "normal"
+	}
+	return i.Priority
+}
+
+// apply sets the download of the configuration to the item
+// the settings passed as arguments when the download was added keep the precedence over the NXGLNK
+func (i queueItem) apply() {
+	conf.NxgLnk = i.NxgLnk
+	for key, value := range map[string]string{
+		"Header":    i.Header,
+		"Title":     i.Title,
+		"Password":  i.Password,
+		"Category":  i.Category,
+		"Subfolder": i.Subfolder,
+	} {
+		if value == "" {
+			continue
+		}
+		reflect.ValueOf(&conf).Elem().FieldByName(key).SetString(value)
+		if slices.Contains(i.Flags, key) {
+			configSources[key] = "flag"
+		} else {
+			configSources[key] = "queue"
+		}
+	}
+}
+
+// loadQueueItem applies the queued download a process of the serve command was started for
+// the download is read from the queue file, so the header and the password are not visible in the process list
+func loadQueueItem() error {
+	value, ok := os.LookupEnv(queueItemEnvVar)
+	if !ok {
+		return nil
+	}
+	// not passed on to the processes started by the download (e.g. the category script)
+	os.Unsetenv(queueItemEnvVar)
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid queue item \"%v\"", value)
+	}
+	queue, err := readQueue()
+	if err != nil {
+		return err
+	}
+	index := queue.index(id)
+	if index < 0 {
+		return fmt.Errorf("no download with the ID %d in the queue", id)
+	}
+	queue.Items[index].apply()
+	return nil
+}
+
+// serve processes the download queue until the program is stopped
+// every download runs in its own process with the current configuration
+func serve() {
+	// downloads of a stopped process are restarted
+	if err := updateQueue(func(queue *downloadQueue) error {
+		for i := range queue.Items {
+			if queue.Items[i].Status == queueStatusDownloading {
+				queue.Items[i].Status = queueStatusQueued
+			}
+		}
+		return nil
+	}); err != nil {
+		Log.Error("Unable to read the queue: %v", err)
+		os.Exit(1)
+	}
+	go serveHeartbeat()
+	Log.Info("Processing the download queue \"%v\"", queueFilePath())
+	for {
+		var item *queueItem
+		if err := updateQueue(func(queue *downloadQueue) error {
+			// the first download with the highest priority
+			for i := range queue.Items {
+				if queue.Items[i].Status == queueStatusQueued && (item == nil || priorities[queue.Items[i].priority()] > priorities[item.priority()]) {
+					item = &queue.Items[i]
+				}
+			}
+			if item != nil {
+				item.Status = queueStatusDownloading
+			}
+			return nil
+		}); err != nil {
+			Log.Error("Unable to read the queue: %v", err)
+		}
+		if item == nil {
+			time.Sleep(time.Duration(commands.Serve.Interval))
+			continue
+		}
+
+		Log.Info("Starting download %d \"%v\"", item.ID, item.name())
+		args := []string{"download"}
+		if item.Profile != "" {
+			args = append(args, "--profile", item.Profile)
+		} else if configSources["Profile"] == "flag" {
+			args = append(args, "--profile", conf.Profile)
+		}
+		cmd := exec.Command(appExec, args...)
+		cmd.Env = append(os.Environ(), envVarName("EndWaitTime")+"=false", fmt.Sprintf("%v=%d", queueItemEnvVar, item.ID))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		downloadErr := cmd.Run()
+		if exitErr, ok := downloadErr.(*exec.ExitError); ok && successful(exitErr.ExitCode()) {
+			// the files were repaired
+			downloadErr = nil
+		}
+
+		id := item.ID
+		if err := updateQueue(func(queue *downloadQueue) error {
+			if index := queue.index(id); index >= 0 {
+				if downloadErr == nil {
+					queue.Items = append(queue.Items[:index], queue.Items[index+1:]...)
+				} else {
+					queue.Items[index].Status = queueStatusFailed
+					queue.Items[index].Error = downloadErr.Error()
+				}
+			}
+			return nil
+		}); err != nil {
+			Log.Error("Unable to update the queue: %v", err)
+		}
+		if downloadErr != nil {
+			Log.Error("Download %d failed: %v", id, downloadErr)
+		} else {
+			Log.Succ("Download %d completed", id)
+		}
+	}
+}
+
+// serveHeartbeat regularly updates the heartbeat file so other processes know the queue is processed
+func serveHeartbeat() {
+	file := filepath.Join(confFilePath, serveHeartbeatFileName)
+	for {
+		if err := os.WriteFile(file, []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+			Log.Debug("Unable to update heartbeat file \"%v\": %v", file, err)
+		}
+		time.Sleep(serveHeartbeatInterval)
+	}
+}
+
+// serveRunning returns true if a serve command is processing the download queue
+func serveRunning() bool {
+	info, err := os.Stat(filepath.Join(confFilePath, serveHeartbeatFileName))
+	return err == nil && time.Since(info.ModTime()) < 3*serveHeartbeatInterval
+}
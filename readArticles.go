@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"sync"
@@ -14,6 +15,7 @@ type Article struct {
 	id       string
 	retries  int
 	partType string
+	index    int // index of the article in the header
 }
 
 type MissingArticles struct {
@@ -27,18 +29,38 @@ func (m *MissingArticles) add(messageId string) {
 	m.parts = append(m.parts, messageId)
 }
 
+func (m *MissingArticles) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parts = nil
+}
+
 func (m *MissingArticles) len() int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return len(m.parts)
 }
 
+// checkMissingArticles aborts the loading of the articles if there are more missing articles than par2 articles
+func checkMissingArticles() {
+	if missingArticles.len() > totalParts["par2"] {
+		abortErr := withExitCode(exitRepairFailed, fmt.Errorf("Number of missing articles too high!"))
+		loadError.CompareAndSwap(nil, &abortErr)
+	}
+}
+
 var (
 	articleCounter  atomic.Int64
 	missingArticles MissingArticles
 
+	// error that aborted the loading of the articles (e.g. too many missing articles)
+	loadError atomic.Pointer[error]
+
+	// the connections are started with the first download and shared by all downloads
+	startConnections sync.Once
+
 	// channels
-	articlesChan       = make(chan Article, 0)
+	articlesChan       chan Article
 	failedArticlesChan = make(chan Article, 0)
 )
 
@@ -56,6 +78,7 @@ func failedArticlesHandler() {
 			if err := TryCatch(func() { articlesChan <- article })(); err != nil {
 				Log.Debug("Error while trying to add article with message id <%v> back to the queue: %v", article.id, err)
 				missingArticles.add(article.id)
+				pendingArticlesWG.Done()
 			} else {
 				Log.Debug("Added article with message id <%v> back to the queue", article.id)
 			}
@@ -63,38 +86,48 @@ func failedArticlesHandler() {
 	}
 }
 
-func readArticles(wg *sync.WaitGroup, connNumber int, retries int) {
+func readArticles(wg *sync.WaitGroup, server *Server, connNumber int, retries int) {
 
 	defer wg.Done()
 
 	var conn *safeConn
 
 	if retries > 0 {
-		Log.Warn("Connection %d waiting %d seconds to reconnect", connNumber, conf.ConnWaitTime)
-		time.Sleep(time.Second * time.Duration(conf.ConnWaitTime))
+		Log.Warn("Connection %d waiting %v to reconnect", connNumber, conf.ConnWaitTime)
+		connectionStates.set(connNumber, connReconnectWait, "")
+		time.Sleep(time.Duration(conf.ConnWaitTime))
 	}
 
-	conn, err := ConnectNNTP()
+	connectionStates.set(connNumber, connConnecting, "")
+	conn, err := ConnectNNTP(server)
 	if err != nil {
 		retries++
 		if retries > conf.ConnRetries {
 			Log.Error("Connection %d failed after %d retries: %v", connNumber, retries-1, err)
+			connectionStates.set(connNumber, connFailed, "")
 			failed := failedConnections.Add(1)
-			if failed >= int64(conf.Connections) {
-				checkForFatalErr(fmt.Errorf("All connections failed"))
+			if failed >= int64(totalConnections()) {
+				checkForFatalErr(withExitCode(exitConnectionError, fmt.Errorf("All connections failed")))
 			}
 			return
 		}
 		Log.Warn("Connection %d error: %v", connNumber, err)
 		wg.Add(1)
-		go readArticles(wg, connNumber, retries)
+		go readArticles(wg, server, connNumber, retries)
 		return
 	} else {
+		activeConnections.set(connNumber, conn)
+		defer activeConnections.remove(connNumber)
 		defer conn.Close()
 	}
 
 	for {
 
+		if paused() {
+			connectionStates.set(connNumber, connPaused, "")
+			waitWhilePaused()
+		}
+		connectionStates.set(connNumber, connIdle, "")
 		article, ok := <-articlesChan
 		if !ok {
 			return
@@ -102,12 +135,27 @@ func readArticles(wg *sync.WaitGroup, connNumber int, retries int) {
 
 		var (
 			body io.Reader
+			data []byte
 			part *yenc.Part
 		)
 
+		// the remaining articles are skipped if the loading was aborted
+		if loadError.Load() != nil {
+			pendingArticlesWG.Done()
+			continue
+		}
+
 		articleCounter.Add(1)
 
+		// parts of previous attempts are loaded from the cache
+		if part, fileSize, ok := articleCache.get(article.id); ok {
+			Log.Debug("Loaded article with message id <%v> from the cache", article.id)
+			deliverPart(article, part, fileSize)
+			continue
+		}
+
 		// read Article
+		connectionStates.set(connNumber, connFetching, article.id)
 		if body, err = read(conn, article.id); err != nil {
 			Log.Debug("Error loading article with message id <%v>: %v", article.id, err)
 			article.retries++
@@ -116,28 +164,50 @@ func readArticles(wg *sync.WaitGroup, connNumber int, retries int) {
 			} else {
 				Log.Warn("After %d retries unable to load article with message id <%v>: %v", article.retries-1, article.id, err)
 				missingArticles.add(article.id)
-				downloadProgressBar.Add(1)
-				if missingArticles.len() > totalParts["par2"] {
-					checkForFatalErr(fmt.Errorf("Number of missing articles too high!"))
-				}
+				pendingArticlesWG.Done()
+				progress.missed("", 0)
+				checkMissingArticles()
+			}
+			if conf.Test == "" && !isProtocolError(err) {
+				// the connection is broken (e.g. aborted by the read timeout), so reconnect
+				Log.Warn("Connection %d lost: %v", connNumber, err)
+				wg.Add(1)
+				go readArticles(wg, server, connNumber, 0)
+				return
 			}
 			continue
 		}
 		// decode article body
-		if part, err = yenc.Decode(body); err != nil {
+		if data, err = io.ReadAll(body); err == nil {
+			speedMeter.add(len(data))
+			speedLimiter.wait(len(data))
+			part, err = yenc.Decode(bytes.NewReader(data))
+		}
+		if err != nil {
 			Log.Warn("Unable to decode body of the article with message id <%v>: %v", article.id, err)
 			missingArticles.add(article.id)
+			progress.missed("", 0)
+			checkMissingArticles()
+			pendingArticlesWG.Done()
 			continue
 		} else {
-			totalBytesLoaded := totalBytesLoaded.Add(part.Size)
-			totalPartsLoaded := totalPartsLoaded.Add(1)
-			// estimate the total size to be downloaded based on the size of the first 10 articles and the total article count
-			if downloadProgressBar != nil && totalPartsLoaded <= 10 {
-				downloadProgressBar.ChangeMax64((totalBytesLoaded / totalPartsLoaded) * int64(totalParts[article.partType]))
-			}
-			fileWriters.runOnce(part.Name)
-			fileChannels.channels[part.Name] <- part
+			fileSize := yencFileSize(data)
+			articleCache.put(article.id, part, fileSize)
+			deliverPart(article, part, fileSize)
 		}
 
 	}
 }
+
+// deliverPart passes the decoded part of the article to the writer of its file
+func deliverPart(article Article, part *yenc.Part, fileSize int64) {
+	if article.partType == "data" {
+		estimateDiskSpace(articleSize(part))
+	}
+	coverageOf(part.Name).register(article.partType, fileSize)
+	progress.discover(part.Name, fileSize, articleSize(part))
+	knownFiles.learn(article.partType, article.index, part, fileSize)
+	loadedArticles.add(article.id)
+	fileWriters.runOnce(part.Name) <- filePart{part, article.id}
+	pendingArticlesWG.Done()
+}
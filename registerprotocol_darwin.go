@@ -1,10 +1,19 @@
 package main
 
-import "os"
+func registerProtocol(headless bool) error {
 
-func registerProtocol() {
+	return errProtocolNotSupported
 
-	Log.Warn("Registering the URL protocol is not yet supported on your system.")
-	os.Exit(0)
+}
+
+func unregisterProtocol() error {
+
+	return errProtocolNotSupported
+
+}
+
+func protocolStatus() (protocolRegistration, error) {
+
+	return protocolRegistration{}, errProtocolNotSupported
 
 }
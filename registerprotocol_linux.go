@@ -1,38 +1,69 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
-func registerProtocol() {
+const (
+	desktopFileName  = "nxglnk.desktop"
+	protocolMimeType = "x-scheme-handler/nxglnk"
+)
 
-	var err error
-	var homeDir string
-	var desktopCommand string
-	var desktopFile string
-	var desktopFilePath string
-	var desktopFileContent string
-	var terminalFailed bool
+// the desktop file is written to $XDG_DATA_HOME/applications and the default handler is set in
+// $XDG_CONFIG_HOME/mimeapps.list (if xdg-mime is not available)
 
-	if homeDir, err = os.UserHomeDir(); err == nil {
+func xdgDataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(homePath, ".local", "share")
+}
 
-		desktopFilePath = filepath.Join(homeDir, ".local/share/applications")
-		desktopFile = filepath.Join(desktopFilePath, "nxglnk.desktop")
+func xdgConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(homePath, ".config")
+}
 
-		var terminals = map[string]string{
-			"gnome-terminal": fmt.Sprintf("--hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appPath, appExec),
-			"konsole":        fmt.Sprintf("--p tabtitle=\"%s\" --hide-menubar --hide-tabbar --workdir=\"%s\" --nofork -e \"%s %%u\"", appName, appPath, appExec),
-			"xfce4-terminal": fmt.Sprintf("--title=\"%s\" --hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
-			"mate-terminal":  fmt.Sprintf("--title=\"%s\" --hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
-			"lxterminal":     fmt.Sprintf("--title=\"%s\" --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
-			"lxterm":         fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
-			"uxterm":         fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
-			"xterm":          fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
-		}
+func desktopFilePath() string {
+	return filepath.Join(xdgDataHome(), "applications", desktopFileName)
+}
+
+// mimeapps.list files that may contain the default handler (the second one is deprecated)
+func mimeAppsFiles() []string {
+	return []string{
+		filepath.Join(xdgConfigHome(), "mimeapps.list"),
+		filepath.Join(xdgDataHome(), "applications", "mimeapps.list"),
+	}
+}
+
+// in headless mode the NXGLNKs are handled by the "handle" command without terminal emulator
+func registerProtocol(headless bool) error {
+
+	var desktopCommand string
+	var terminalFailed bool
+
+	var terminals = map[string]string{
+		"gnome-terminal": fmt.Sprintf("--hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appPath, appExec),
+		"konsole":        fmt.Sprintf("--p tabtitle=\"%s\" --hide-menubar --hide-tabbar --workdir=\"%s\" --nofork -e \"%s %%u\"", appName, appPath, appExec),
+		"xfce4-terminal": fmt.Sprintf("--title=\"%s\" --hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
+		"mate-terminal":  fmt.Sprintf("--title=\"%s\" --hide-menubar --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
+		"lxterminal":     fmt.Sprintf("--title=\"%s\" --geometry=100x16 --working-directory=\"%s\" -e \"%s %%u\"", appName, appPath, appExec),
+		"lxterm":         fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
+		"uxterm":         fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
+		"xterm":          fmt.Sprintf("-geometry 100x16+200+200 -e \"%s %%u\"", appExec),
+	}
 
+	if headless {
+		desktopCommand = fmt.Sprintf("\"%s\" handle %%u", appExec)
+	} else {
 		Log.Info("Searching for terminal emulators ...")
 		for name, command := range terminals {
 			fmt.Println()
@@ -43,63 +74,164 @@ func registerProtocol() {
 				break
 			}
 		}
+	}
 
-		if desktopCommand == "" {
-			terminalFailed = true
-			fmt.Println()
-			Log.Warn("No terminal emulator found!")
-			Log.Info("Please enter the path to your favorite terminal emulator in:")
-			Log.Info("%s", desktopFilePath)
-			Log.Info("and change parameters if necessary.")
-			desktopCommand = fmt.Sprintf("<Replace with path to terminal emulator> --title \"%s\" --hide-menubar --geometry=100x40 --working-directory=\"%s\" --command=\"%s %%u\"", appName, appPath, appExec)
-		}
+	if desktopCommand == "" {
+		terminalFailed = true
+		fmt.Println()
+		Log.Warn("No terminal emulator found!")
+		Log.Info("Please enter the path to your favorite terminal emulator in:")
+		Log.Info("%s", desktopFilePath())
+		Log.Info("and change parameters if necessary.")
+		desktopCommand = fmt.Sprintf("<Replace with path to terminal emulator> --title \"%s\" --hide-menubar --geometry=100x40 --working-directory=\"%s\" --command=\"%s %%u\"", appName, appPath, appExec)
+	}
 
-		desktopFileContent = fmt.Sprintf(`[Desktop Entry]
+	desktopFileContent := fmt.Sprintf(`[Desktop Entry]
 Type=Application
 Name=nxglnk
 Exec=%s
 Path=%s
-MimeType=x-scheme-handler/nxglnk;
+MimeType=%s;
 NoDisplay=true
-Terminal=false				
-`, desktopCommand, appPath)
+Terminal=false
+`, desktopCommand, appPath, protocolMimeType)
 
-		fmt.Println()
-		Log.Info("Writing desktop file '%s' ... ", desktopFile)
-		os.MkdirAll(desktopFilePath, os.ModePerm)
-		if err = os.WriteFile(desktopFile, []byte(desktopFileContent), 0644); err == nil {
-			Log.Info("Desktop file successfuly written")
-		} else {
-			Log.Error("Writing desktop file failed: %s", err.Error())
-			Log.Error("Unable to register 'nxglnk' URL protocol")
-			os.Exit(1)
+	fmt.Println()
+	Log.Info("Writing desktop file '%s' ... ", desktopFilePath())
+	if err := os.MkdirAll(filepath.Dir(desktopFilePath()), os.ModePerm); err != nil {
+		return fmt.Errorf("writing desktop file failed: %v", err)
+	}
+	if err := os.WriteFile(desktopFilePath(), []byte(desktopFileContent), 0644); err != nil {
+		return fmt.Errorf("writing desktop file failed: %v", err)
+	}
+	Log.Info("Desktop file successfuly written")
+
+	fmt.Println()
+	Log.Info("Adding nxglnk to mimeapps.list ... ")
+	if path, _ := exec.LookPath("xdg-mime"); path != "" {
+		if output, err := exec.Command(path, "default", desktopFileName, protocolMimeType).CombinedOutput(); err != nil {
+			return fmt.Errorf("adding nxglnk to mimeapps.list failed: %v %s", err, strings.TrimSpace(string(output)))
 		}
+	} else if err := updateMimeApps(mimeAppsFiles()[0], true); err != nil {
+		return fmt.Errorf("adding nxglnk to mimeapps.list failed: %v", err)
+	}
+	Log.Info("nxglnk successfuly added to mimeapps.list")
 
-		fmt.Println()
-		Log.Info("Adding nxglnk to mimeapps.list ... ")
-		if path, err := exec.LookPath("xdg-mime"); path != "" {
-			cmd := exec.Command(path, "default", "nxglnk.desktop", "x-scheme-handler/nxglnk")
-			if err = cmd.Run(); err == nil {
-				Log.Info("nxglnk successfuly added to mimeapps.list")
-			} else {
-				Log.Error("Adding nxglnk to mimeapps.list failed: %s", err.Error())
-				Log.Error("Unable to register 'nxglnk' URL protocol")
-				os.Exit(1)
-			}
-		} else {
-			Log.Error("Adding nxglnk to mimeapps.list failed: %s", err.Error())
-			Log.Error("Unable to register 'nxglnk' URL protocol")
-			os.Exit(1)
+	if terminalFailed {
+		Log.Warn("Don't forget to change the nxglnk.desktop file or %s will not work!", appName)
+	}
+	return nil
+
+}
+
+func unregisterProtocol() error {
+
+	var errs []error
+	if err := os.Remove(desktopFilePath()); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("removing desktop file failed: %v", err))
+	}
+	for _, file := range mimeAppsFiles() {
+		if err := updateMimeApps(file, false); err != nil {
+			errs = append(errs, fmt.Errorf("removing nxglnk from \"%v\" failed: %v", file, err))
 		}
+	}
+	return errors.Join(errs...)
+
+}
 
+func protocolStatus() (protocolRegistration, error) {
+
+	var status protocolRegistration
+	content, err := os.ReadFile(desktopFilePath())
+	if os.IsNotExist(err) {
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	status.registered = true
+	status.location = desktopFilePath()
+	for _, line := range strings.Split(string(content), "\n") {
+		if command, ok := strings.CutPrefix(strings.TrimSpace(line), "Exec="); ok {
+			status.command = command
+		}
+	}
+	for _, file := range mimeAppsFiles() {
+		handler, err := mimeAppsDefault(file)
+		if err != nil {
+			return status, err
+		}
+		if handler != "" {
+			status.isDefault = handler == desktopFileName
+			break
+		}
 	}
+	return status, nil
 
-	if !terminalFailed {
-		Log.Info("URL protocol 'nxglnk' successfuly registered to '%s'", appExec)
-	} else {
-		Log.Info("URL protocol 'nxglnk' registered to '%s'", appExec)
-		Log.Warn("Don't forget to change the nxglnk.desktop file or %s will not work!", appName)
+}
+
+// updateMimeApps sets (or removes) nxglnk.desktop as default application
+// for the NXGLNK scheme in the mimeapps.list file
+func updateMimeApps(file string, register bool) error {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) && !register {
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == protocolMimeType {
+			if register {
+				continue
+			}
+			// only this program is removed, the other handlers are kept
+			var handlers []string
+			for _, handler := range strings.Split(value, ";") {
+				if handler = strings.TrimSpace(handler); handler != "" && handler != desktopFileName {
+					handlers = append(handlers, handler)
+				}
+			}
+			if len(handlers) == 0 {
+				continue
+			}
+			line = key + "=" + strings.Join(handlers, ";") + ";"
+		}
+		lines = append(lines, line)
+	}
+	if register {
+		entry := protocolMimeType + "=" + desktopFileName
+		if index := slices.Index(lines, "[Default Applications]"); index >= 0 {
+			lines = slices.Insert(lines, index+1, entry)
+		} else {
+			if len(lines) == 1 && lines[0] == "" {
+				lines = nil
+			}
+			lines = append(lines, "[Default Applications]", entry)
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
 	}
-	os.Exit(0)
+	return os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
 
+// mimeAppsDefault returns the default application for the NXGLNK scheme in the mimeapps.list file
+func mimeAppsDefault(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	section := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+		} else if key, value, ok := strings.Cut(line, "="); ok && section == "[Default Applications]" && strings.TrimSpace(key) == protocolMimeType {
+			handler, _, _ := strings.Cut(strings.TrimSpace(value), ";")
+			return handler, nil
+		}
+	}
+	return "", nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtocolRegistration(t *testing.T) {
+	dataHome, configHome := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	// without xdg-mime the mimeapps.list is updated directly
+	t.Setenv("PATH", t.TempDir())
+
+	mimeApps := filepath.Join(configHome, "mimeapps.list")
+	other := "[Default Applications]\ntext/html=firefox.desktop\nx-scheme-handler/nxglnk=other.desktop\n"
+	if err := os.WriteFile(mimeApps, []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := protocolStatus()
+	if err != nil || status.registered || status.isDefault {
+		t.Fatalf("protocolStatus() before registration = %+v, %v", status, err)
+	}
+
+	if err = registerProtocol(true); err != nil {
+		t.Fatalf("registerProtocol() error = %v", err)
+	}
+	desktopFile := filepath.Join(dataHome, "applications", desktopFileName)
+	content, err := os.ReadFile(desktopFile)
+	if err != nil {
+		t.Fatalf("desktop file not written: %v", err)
+	}
+	command := "\"" + appExec + "\" handle %u"
+	for _, line := range []string{"[Desktop Entry]", "Exec=" + command, "Path=" + appPath, "MimeType=" + protocolMimeType + ";", "Terminal=false"} {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Errorf("desktop file does not contain %q:\n%s", line, content)
+		}
+	}
+	content, _ = os.ReadFile(mimeApps)
+	if want := "[Default Applications]\nx-scheme-handler/nxglnk=nxglnk.desktop\ntext/html=firefox.desktop\n"; string(content) != want {
+		t.Errorf("mimeapps.list after registration = %q, want %q", content, want)
+	}
+
+	status, err = protocolStatus()
+	if err != nil {
+		t.Fatalf("protocolStatus() error = %v", err)
+	}
+	if !status.registered || !status.isDefault || status.location != desktopFile || status.command != command {
+		t.Errorf("protocolStatus() after registration = %+v", status)
+	}
+
+	// another program was made the default handler afterwards
+	other = "[Default Applications]\ntext/html=firefox.desktop\nx-scheme-handler/nxglnk=other.desktop;nxglnk.desktop;\n"
+	if err = os.WriteFile(mimeApps, []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = unregisterProtocol(); err != nil {
+		t.Fatalf("unregisterProtocol() error = %v", err)
+	}
+	if _, err = os.Stat(desktopFile); !os.IsNotExist(err) {
+		t.Errorf("desktop file not removed: %v", err)
+	}
+	content, _ = os.ReadFile(mimeApps)
+	if want := "[Default Applications]\ntext/html=firefox.desktop\nx-scheme-handler/nxglnk=other.desktop;\n"; string(content) != want {
+		t.Errorf("mimeapps.list after unregistration = %q, want %q", content, want)
+	}
+	status, err = protocolStatus()
+	if err != nil || status.registered || status.isDefault {
+		t.Errorf("protocolStatus() after unregistration = %+v, %v", status, err)
+	}
+}
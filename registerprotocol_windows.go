@@ -1,48 +1,101 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"strings"
 
 	"golang.org/x/sys/windows/registry"
 )
 
-func registerProtocol() {
+const protocolKey = "SOFTWARE\\Classes\\nxglnk"
 
-	var k registry.Key
-	var err error
-	prefix := "SOFTWARE\\Classes\\"
-	urlScheme := "nxglnk"
-	basePath := prefix + urlScheme
-	permission := uint32(registry.QUERY_VALUE | registry.SET_VALUE)
-	baseKey := registry.CURRENT_USER
+// in headless mode the NXGLNKs are handled by the "handle" command
+func registerProtocol(headless bool) error {
 
-	// create key
-	k, _, err = registry.CreateKey(baseKey, basePath, permission)
-
-	// set description
-	err = k.SetStringValue("", appName+" app")
-	err = k.SetStringValue("URL Protocol", "")
-
-	// set icon
-	k, _, err = registry.CreateKey(baseKey, basePath+"\\DefaultIcon", permission)
-	err = k.SetStringValue("", appExec+",1")
+	command := fmt.Sprintf("\"%s\" \"%%1\"", appExec)
+	if headless {
+		command = fmt.Sprintf("\"%s\" handle \"%%1\"", appExec)
+	}
 
-	// create tree
-	_, _, err = registry.CreateKey(baseKey, basePath+"\\shell", permission)
-	_, _, err = registry.CreateKey(baseKey, basePath+"\\shell\\open", permission)
-	k, _, err = registry.CreateKey(baseKey, basePath+"\\shell\\open\\command", permission)
+	var errs []error
+	for _, value := range []struct {
+		path   string
+		name   string
+		value  string
+		expand bool
+	}{
+		// description
+		{protocolKey, "", appName + " app", false},
+		{protocolKey, "URL Protocol", "", false},
+		// icon
+		{protocolKey + "\\DefaultIcon", "", appExec + ",1", false},
+		// open command
+		{protocolKey + "\\shell\\open\\command", "", command, true},
+	} {
+		if err := setRegistryValue(value.path, value.name, value.value, value.expand); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 
-	// set open command
-	cmdString := fmt.Sprintf("\"%s\" \"%%1\"", appExec)
-	err = k.SetExpandStringValue("", cmdString)
+}
 
+// setRegistryValue creates the key (and its parents) and sets the value
+func setRegistryValue(path string, name string, value string, expand bool) error {
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.QUERY_VALUE|registry.SET_VALUE)
 	if err != nil {
-		Log.Error("Unable to register 'nxglnk' URL protocol: %s", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("creating key \"%s\" failed: %v", path, err)
+	}
+	defer k.Close()
+	if expand {
+		err = k.SetExpandStringValue(name, value)
 	} else {
-		Log.Info("URL protocol 'nxglnk' successfuly registered to '%s'", appExec)
-		os.Exit(0)
+		err = k.SetStringValue(name, value)
+	}
+	if err != nil {
+		return fmt.Errorf("setting value \"%s\" of key \"%s\" failed: %v", name, path, err)
+	}
+	return nil
+}
+
+func unregisterProtocol() error {
+
+	// keys must be deleted starting with the subkeys
+	var errs []error
+	for _, path := range []string{
+		protocolKey + "\\shell\\open\\command",
+		protocolKey + "\\shell\\open",
+		protocolKey + "\\shell",
+		protocolKey + "\\DefaultIcon",
+		protocolKey,
+	} {
+		if err := registry.DeleteKey(registry.CURRENT_USER, path); err != nil && !errors.Is(err, registry.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("deleting key \"%s\" failed: %v", path, err))
+		}
+	}
+	return errors.Join(errs...)
+
+}
+
+func protocolStatus() (protocolRegistration, error) {
+
+	var status protocolRegistration
+	k, err := registry.OpenKey(registry.CURRENT_USER, protocolKey+"\\shell\\open\\command", registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	defer k.Close()
+	if status.command, _, err = k.GetStringValue(""); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return status, err
 	}
+	status.registered = true
+	status.location = "HKEY_CURRENT_USER\\" + protocolKey
+	// the classes of the current user take precedence over the ones of the system,
+	// so the program is the default handler if the registered command runs it
+	status.isDefault = strings.HasPrefix(strings.ToLower(status.command), strings.ToLower("\""+appExec+"\" "))
+	return status, nil
 
 }
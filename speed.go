@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// number of seconds the speed is recorded for
+const speedHistory = 60
+
+// SpeedLimiter limits the download speed of all connections together
+type SpeedLimiter struct {
+	mu    sync.Mutex
+	limit atomic.Int64 // bytes per second, 0 = unlimited
+	next  time.Time    // time the bytes loaded so far are allowed at
+}
+
+// wait delays the connection after it loaded the bytes until the limit allows them
+func (l *SpeedLimiter) wait(bytes int) {
+	limit := l.limit.Load()
+	if limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(bytes) / float64(limit) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// SpeedMeter records the loaded bytes per second
+type SpeedMeter struct {
+	mu      sync.Mutex
+	seconds [speedHistory]int64
+	last    int64 // unix time of the current second
+}
+
+// add adds the loaded bytes to the current second
+func (m *SpeedMeter) add(bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance()
+	m.seconds[m.last%speedHistory] += int64(bytes)
+}
+
+// advance clears the seconds passed since the last call, m.mu must be held
+func (m *SpeedMeter) advance() {
+	now := time.Now().Unix()
+	for s := max(m.last+1, now-speedHistory+1); s <= now; s++ {
+		m.seconds[s%speedHistory] = 0
+	}
+	m.last = max(m.last, now)
+}
+
+// history returns the bytes per second of the completed seconds, the oldest first
+func (m *SpeedMeter) history() []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.advance()
+	history := make([]int64, 0, speedHistory-1)
+	for s := m.last - speedHistory + 1; s < m.last; s++ {
+		history = append(history, m.seconds[s%speedHistory])
+	}
+	return history
+}
+
+// speed returns the average bytes per second of the last seconds
+func (m *SpeedMeter) speed(seconds int) int64 {
+	history := m.history()
+	seconds = min(seconds, len(history))
+	var sum int64
+	for _, bytes := range history[len(history)-seconds:] {
+		sum += bytes
+	}
+	return sum / int64(max(seconds, 1))
+}
+
+var (
+	speedLimiter SpeedLimiter
+	speedMeter   SpeedMeter
+
+	// true while the download is paused by the user
+	userPaused atomic.Bool
+)
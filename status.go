@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// states of a connection
+const (
+	connConnecting    = "connecting"
+	connIdle          = "idle"
+	connFetching      = "fetching"
+	connPaused        = "paused"
+	connReconnectWait = "reconnect wait"
+	connFailed        = "failed"
+)
+
+// state of a connection with the message id of the article being fetched
+type connectionState struct {
+	number    int
+	state     string
+	messageID string
+	since     time.Time
+}
+
+// ConnectionStates holds the state of every connection of the connection pool
+type ConnectionStates struct {
+	mu     sync.Mutex
+	states map[int]*connectionState
+}
+
+func (c *ConnectionStates) set(connNumber int, state string, messageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil {
+		c.states = make(map[int]*connectionState)
+	}
+	c.states[connNumber] = &connectionState{number: connNumber, state: state, messageID: messageID, since: time.Now()}
+}
+
+// list returns the states ordered by the connection number
+func (c *ConnectionStates) list() []connectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var states []connectionState
+	for _, state := range c.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].number < states[j].number })
+	return states
+}
+
+// current stage of the download (e.g. downloading, repairing, extracting) with its progress
+type downloadStage struct {
+	mu      sync.Mutex
+	name    string
+	percent int // -1 if unknown
+}
+
+func (s *downloadStage) set(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+	s.percent = -1
+	emitEvent("stage", map[string]interface{}{"stage": name})
+}
+
+func (s *downloadStage) setPercent(percent int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if percent != s.percent {
+		emitEvent("progress", map[string]interface{}{"stage": s.name, "percent": percent})
+	}
+	s.percent = percent
+}
+
+func (s *downloadStage) get() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name, s.percent
+}
+
+var (
+	connectionStates ConnectionStates
+	stage            downloadStage
+)
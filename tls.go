@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSError is returned if the TLS handshake with the usenet server failed
+// as opposed to errors on the NNTP level
+type TLSError struct {
+	Server *Server
+	Err    error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("TLS handshake with usenet server \"%v\" failed: %v", e.Server, e.Err)
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig creates the TLS configuration for the usenet server
+func newTLSConfig(server *Server) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: server.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if server.TLSServerName != "" {
+		tlsConfig.ServerName = server.TLSServerName
+	}
+	if server.TLSMinVersion != "" {
+		version, ok := tlsVersions[server.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown minimum TLS version \"%v\" (must be 1.0, 1.1, 1.2 or 1.3)", server.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if server.TLSCAFile != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(homeRelativePath(server.TLSCAFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %v", err)
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA file \"%v\"", server.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if server.TLSCertFile != "" || server.TLSKeyFile != "" {
+		if server.TLSCertFile == "" || server.TLSKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key file must both be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(homeRelativePath(server.TLSCertFile), homeRelativePath(server.TLSKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(server.TLSPins) > 0 {
+		pins := make(map[string]bool)
+		for _, pin := range server.TLSPins {
+			pin = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(pin), ":", ""))
+			if decoded, err := hex.DecodeString(pin); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid certificate pin \"%v\" (must be a hex encoded SHA-256 hash)", pin)
+			}
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server did not provide a certificate")
+			}
+			hash := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if !pins[hex.EncodeToString(hash[:])] {
+				return fmt.Errorf("certificate public key hash %x does not match any of the pinned hashes", hash)
+			}
+			return nil
+		}
+	}
+	if server.TLSSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// tlsHandshake upgrades the connection to a TLS connection
+func tlsHandshake(conn net.Conn, server *Server) (net.Conn, error) {
+	tlsConn := tls.Client(conn, server.tlsConfig)
+	ctx := context.Background()
+	if conf.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(conf.DialTimeout))
+		defer cancel()
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, &TLSError{server, err}
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	tuiRefreshInterval = 250 * time.Millisecond
+	tuiMaxLogLines     = 1000
+
+	// step the speed limit is changed by with the keys + and -, below the step it is doubled or halved
+	speedLimitStep = 1 << 20
+	minSpeedLimit  = 16 << 10
+)
+
+// logged line with the writer it would have been written to without the terminal interface
+type tuiLogLine struct {
+	w    io.Writer
+	line string
+}
+
+// full-screen terminal interface showing the state of the connections and the progress of the files
+type terminalUI struct {
+	mu     sync.Mutex
+	draw   sync.Mutex // the interface is drawn by the render loop and after key presses
+	active bool
+	state  *term.State
+	logs   []tuiLogLine
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+var tui terminalUI
+
+func tuiActive() bool {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	return tui.active
+}
+
+// startTUI shows the terminal interface if it is enabled and the program runs in a terminal
+func startTUI() {
+	if !conf.TUI || conf.Headless || tuiActive() {
+		return
+	}
+	if !term.IsTerminal(int(os.Stdout.Fd())) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		Log.Debug("Not running in a terminal, the terminal interface is disabled")
+		return
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		Log.Warn("Unable to show the terminal interface: %v", err)
+		return
+	}
+	tui.mu.Lock()
+	tui.active = true
+	tui.state = state
+	tui.logs = nil
+	tui.stop = make(chan struct{})
+	tui.done = make(chan struct{})
+	tui.mu.Unlock()
+
+	fmt.Print("\033[?1049h\033[?25l") // switch to the alternate screen and hide the cursor
+	go tui.readKeys()
+	go tui.renderLoop()
+}
+
+// stopTUI restores the terminal and prints the lines logged while the interface was shown
+func stopTUI() {
+	tui.mu.Lock()
+	if !tui.active {
+		tui.mu.Unlock()
+		return
+	}
+	tui.active = false
+	close(tui.stop)
+	tui.mu.Unlock()
+
+	<-tui.done
+	tui.draw.Lock()
+	defer tui.draw.Unlock()
+	fmt.Print("\033[?25h\033[?1049l") // show the cursor and leave the alternate screen
+	term.Restore(int(os.Stdin.Fd()), tui.state)
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	for _, log := range tui.logs {
+		fmt.Fprint(log.w, log.line)
+	}
+	tui.logs = nil
+}
+
+// log keeps the line for the log section, false if the interface is not shown
+func (t *terminalUI) log(w io.Writer, line string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active {
+		return false
+	}
+	t.logs = append(t.logs, tuiLogLine{w, line})
+	if len(t.logs) > tuiMaxLogLines {
+		t.logs = t.logs[len(t.logs)-tuiMaxLogLines:]
+	}
+	return true
+}
+
+// readKeys handles the keys pressed while the interface is shown
+func (t *terminalUI) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil || !tuiActive() {
+			return
+		}
+		for _, key := range buf[:n] {
+			switch key {
+			case 'p', 'P', ' ':
+				if userPaused.Load() {
+					userPaused.Store(false)
+					Log.Info("Download resumed")
+				} else {
+					userPaused.Store(true)
+					Log.Info("Download paused")
+				}
+			case '+':
+				if limit := speedLimiter.limit.Load(); limit > 0 {
+					setSpeedLimit(changeSpeedLimit(limit, true))
+				}
+			case '-':
+				limit := speedLimiter.limit.Load()
+				if limit == 0 {
+					// start with the current speed
+					limit = max(speedMeter.speed(5), minSpeedLimit)
+				}
+				setSpeedLimit(changeSpeedLimit(limit, false))
+			case 'u', 'U':
+				setSpeedLimit(0)
+			case 'q', 'Q', 3: // 3 = Ctrl+C
+				stopTUI()
+				Log.Error("Download aborted")
+				exit(1)
+			}
+		}
+		t.render()
+	}
+}
+
+// barWriter returns the writer of the progress bars, they are only shown on a terminal without the interface
+func barWriter() io.Writer {
+	if !interactive() {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// changeSpeedLimit returns the next higher or lower speed limit
+func changeSpeedLimit(limit int64, increase bool) int64 {
+	switch {
+	case increase && limit < speedLimitStep:
+		return min(limit*2, speedLimitStep)
+	case increase:
+		return (limit/speedLimitStep + 1) * speedLimitStep
+	case limit > speedLimitStep:
+		return (limit - 1) / speedLimitStep * speedLimitStep
+	default:
+		return max(limit/2, minSpeedLimit)
+	}
+}
+
+func setSpeedLimit(limit int64) {
+	speedLimiter.limit.Store(limit)
+	if limit > 0 {
+		Log.Info("Speed limit set to %v/s", formatBytes(limit))
+	} else {
+		Log.Info("Speed limit removed")
+	}
+}
+
+func (t *terminalUI) renderLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+	for {
+		t.render()
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// render draws the interface
+func (t *terminalUI) render() {
+	t.draw.Lock()
+	defer t.draw.Unlock()
+	if !tuiActive() {
+		return
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 10 {
+		width, height = 80, 24
+	}
+
+	done, total, files := progress.snapshot()
+	speed := speedMeter.speed(3)
+
+	// status
+	var top []string
+	top = append(top, fmt.Sprintf("%v %v - %v", appName, appVersion, downloadName()))
+	name, percent := stage.get()
+	status := "Stage: " + name
+	if percent >= 0 {
+		status += fmt.Sprintf(" (%d%%)", percent)
+	}
+	if userPaused.Load() {
+		status += "  [PAUSED]"
+	} else if downloadPaused.Load() {
+		status += "  [PAUSED: LOW DISK SPACE]"
+	}
+	top = append(top, status)
+	limit := "unlimited"
+	if l := speedLimiter.limit.Load(); l > 0 {
+		limit = formatBytes(l) + "/s"
+	}
+	eta := "-"
+	if speed > 0 && total > done {
+		eta = (time.Duration((total-done)/speed) * time.Second).String()
+	}
+	top = append(top, fmt.Sprintf("Progress: %v of %v  Speed: %v/s  Limit: %v  ETA: %v", formatBytes(done), formatBytes(total), formatBytes(speed), limit, eta))
+	top = append(top, fmt.Sprintf("Missing parts: %d  (par2 parts: %d)", missingArticles.len(), totalParts["par2"]))
+
+	// connections
+	connections := []string{"", "Connections"}
+	for _, c := range connectionStates.list() {
+		line := fmt.Sprintf("  %3d  %-14s %6v", c.number, c.state, time.Since(c.since).Round(time.Second))
+		if c.messageID != "" {
+			line += "  <" + c.messageID + ">"
+		}
+		connections = append(connections, line)
+	}
+
+	// files
+	fileLines := []string{"", "Files"}
+	barWidth := max(10, min(40, width-60))
+	for _, file := range files {
+		fraction := 0.0
+		if file.size > 0 {
+			fraction = float64(file.loaded) / float64(file.size)
+		}
+		line := fmt.Sprintf("  %v %3.0f%%  %d/%d parts", textBar(barWidth, fraction), fraction*100, file.complete, file.parts)
+		if file.missing > 0 {
+			line += fmt.Sprintf(", %d missing", file.missing)
+		}
+		fileLines = append(fileLines, line+"  "+file.name)
+	}
+
+	// speed graph
+	graph := []string{"", "Speed (last minute)", "  " + speedGraph(speedMeter.history(), width-4)}
+
+	footer := []string{"", "p = pause/resume   + / - = speed limit   u = unlimited   q = abort"}
+
+	// the log gets the remaining lines
+	fixed := len(top) + len(graph) + len(footer)
+	remaining := height - fixed - 2 // title of the log section
+	connections = limitLines(connections, remaining/3)
+	fileLines = limitLines(fileLines, (remaining-len(connections))/2)
+	remaining -= len(connections) + len(fileLines)
+
+	t.mu.Lock()
+	var logs []string
+	for i := max(0, len(t.logs)-max(remaining, 0)); i < len(t.logs); i++ {
+		logs = append(logs, strings.TrimRight(t.logs[i].line, "\r\n"))
+	}
+	t.mu.Unlock()
+
+	var lines []string
+	lines = append(lines, top...)
+	lines = append(lines, connections...)
+	lines = append(lines, fileLines...)
+	lines = append(lines, graph...)
+	lines = append(lines, "", "Log")
+	lines = append(lines, logs...)
+	for len(lines) < height-len(footer) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+
+	var screen strings.Builder
+	screen.WriteString("\033[H") // move the cursor to the top left
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		if i > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(truncate(line, width))
+		screen.WriteString("\033[K") // clear the rest of the line
+	}
+	fmt.Print(screen.String())
+}
+
+// limitLines shortens the section to the number of lines, the title is kept
+func limitLines(lines []string, limit int) []string {
+	limit = max(limit, 3)
+	if len(lines) <= limit {
+		return lines
+	}
+	hidden := len(lines) - limit + 1
+	return append(lines[:limit-1:limit-1], fmt.Sprintf("  ... %d more", hidden))
+}
+
+// textBar returns a progress bar of the width
+func textBar(width int, fraction float64) string {
+	filled := int(fraction * float64(width))
+	filled = max(0, min(width, filled))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+// speedGraph returns the speed history as a sparkline with the maximum speed
+func speedGraph(history []int64, width int) string {
+	levels := []rune(" ▁▂▃▄▅▆▇█")
+	var peak int64
+	for _, bytes := range history {
+		peak = max(peak, bytes)
+	}
+	label := fmt.Sprintf("  max %v/s", formatBytes(peak))
+	if width -= len(label); width < len(history) {
+		history = history[len(history)-max(width, 0):]
+	}
+	var graph strings.Builder
+	for _, bytes := range history {
+		level := 0
+		if peak > 0 {
+			level = int(bytes * int64(len(levels)-1) / peak)
+		}
+		graph.WriteRune(levels[level])
+	}
+	return graph.String() + label
+}
+
+// truncate shortens the line to the width of the terminal
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return line
+}
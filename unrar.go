@@ -18,6 +18,7 @@ import (
 func unrar() error {
 
 	Log.Info("Starting unrar process")
+	stage.set("Extracting files")
 
 	var (
 		rarExitCodes   map[int]string
@@ -74,7 +75,7 @@ func unrar() error {
 
 	cmd := exec.Command(conf.RarExe, parameters...)
 	Log.Debug("Unrar command: %s", cmd.String())
-	if conf.Debug || conf.Verbose > 0 {
+	if conf.Debug || conf.Verbose > 0 || tuiActive() {
 		// create a pipe for the output of the program
 		if cmdReader, err = cmd.StdoutPipe(); err != nil {
 			return err
@@ -89,6 +90,7 @@ func unrar() error {
 					progressbar.OptionThrottle(time.Millisecond*100),
 					progressbar.OptionShowElapsedTimeOnFinish(),
 					progressbar.OptionOnCompletion(newline),
+					progressbar.OptionSetWriter(barWriter()),
 				)
 			}
 
@@ -99,11 +101,12 @@ func unrar() error {
 						Log.Debug("RAR: %v", output)
 					}
 				}
-				if conf.Verbose > 0 {
-					exp := regexp.MustCompile(`0*(\d+)%`)
-					if output != "" && exp.MatchString(output) {
-						percentStr := exp.FindStringSubmatch(output)
-						percentInt, _ := strconv.Atoi(percentStr[1])
+				exp := regexp.MustCompile(`0*(\d+)%`)
+				if output != "" && exp.MatchString(output) {
+					percentStr := exp.FindStringSubmatch(output)
+					percentInt, _ := strconv.Atoi(percentStr[1])
+					stage.setPercent(percentInt)
+					if rarProgressBar != nil {
 						rarProgressBar.Set(percentInt)
 					}
 				}
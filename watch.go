@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// subfolders of the watch folders the files are moved to
+	watchProcessedFolder = "processed"
+	watchFailedFolder    = "failed"
+
+	// time without changes before a file is processed, so files are not read while being written
+	watchSettleTime = 2 * time.Second
+)
+
+// extensions of the files that are processed
+// .nxglnk and .txt files contain one NXGLNK or header per line (see the batch command)
+var watchExtensions = []string{".nxglnk", ".txt"}
+
+// runWatchCommand watches the folders for dropped files and adds their downloads to the download queue
+func runWatchCommand() {
+	var dirs []string
+	for _, dir := range commands.Watch.Dirs {
+		dirs = append(dirs, workRelativePath(dir))
+	}
+	if len(dirs) == 0 {
+		for _, dir := range conf.WatchFolders {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, homeRelativePath(dir))
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		writeUsage(argParser)
+		Log.Error("No watch folder provided (pass the folders as arguments or set WatchFolders in the configuration)")
+		os.Exit(exitInvalidInput)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		Log.Error("Unable to watch the folders: %v", err)
+		os.Exit(1)
+	}
+	defer watcher.Close()
+
+	// files that were changed and the time of the last change
+	pending := make(map[string]time.Time)
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			Log.Error("\"%v\" is not a directory", dir)
+			os.Exit(exitInvalidInput)
+		}
+		if err := watcher.Add(dir); err != nil {
+			Log.Error("Unable to watch \"%v\": %v", dir, err)
+			os.Exit(1)
+		}
+		// files dropped while the folder was not watched
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			Log.Error("Unable to read \"%v\": %v", dir, err)
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			pending[filepath.Join(dir, entry.Name())] = time.Time{}
+		}
+		Log.Info("Watching \"%v\"", dir)
+	}
+	if !serveRunning() {
+		Log.Warn("No serve command is running, the downloads are only added to the download queue")
+	}
+
+	ticker := time.NewTicker(watchSettleTime / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				pending[event.Name] = time.Now()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			Log.Warn("Error while watching the folders: %v", err)
+		case <-ticker.C:
+			for file, changed := range pending {
+				if time.Since(changed) >= watchSettleTime {
+					delete(pending, file)
+					processWatchFile(file)
+				}
+			}
+		}
+	}
+}
+
+// processWatchFile adds the downloads of the file to the download queue
+// and moves it to the processed or the failed subfolder
+func processWatchFile(file string) {
+	info, err := os.Stat(file)
+	if err != nil || !info.Mode().IsRegular() || !isWatchFile(file) {
+		return
+	}
+	Log.Info("Processing \"%v\"", file)
+
+	items, err := readWatchFile(file)
+
+	// the downloads are only added if all of them are valid, so the file can be fixed and dropped again
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	} else if len(items) == 0 {
+		errs = append(errs, errors.New("the file contains no download"))
+	}
+	for i := range items {
+		if err := items[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("download %d: %v", i+1, err))
+		}
+	}
+	if len(errs) == 0 {
+		if added, err := enqueueAll(items); err != nil {
+			errs = append(errs, err)
+		} else {
+			for _, item := range added {
+				Log.Info("Download %d added to the queue", item.ID)
+				if conf.Notify {
+					notify("Download added to the queue", item.name())
+				}
+			}
+		}
+	}
+
+	folder := watchProcessedFolder
+	if err := errors.Join(errs...); err != nil {
+		folder = watchFailedFolder
+		Log.Error("No download of \"%v\" added to the queue: %v", filepath.Base(file), err)
+	}
+	target, err := moveWatchFile(file, folder)
+	if err != nil {
+		Log.Error("Unable to move \"%v\" to the %v folder: %v", file, folder, err)
+		return
+	}
+	if len(errs) > 0 {
+		// the reason is written next to the failed file
+		if err := os.WriteFile(target+".error", []byte(errors.Join(errs...).Error()+"\n"), 0644); err != nil {
+			Log.Warn("Unable to write the error file: %v", err)
+		}
+	}
+}
+
+func isWatchFile(file string) bool {
+	if strings.HasPrefix(filepath.Base(file), ".") {
+		return false
+	}
+	for _, ext := range watchExtensions {
+		if strings.EqualFold(filepath.Ext(file), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// readWatchFile reads the NXGLNKs and headers of the file, one per line
+func readWatchFile(file string) ([]queueItem, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	batch, err := readBatchItems(f)
+	if err != nil {
+		return nil, err
+	}
+	var items []queueItem
+	for _, b := range batch {
+		item := queueItem{NxgLnk: b.NxgLnk, Header: b.Header, Title: b.Title, Password: b.Password}
+		if b.NxgLnk != "" {
+			link, err := parseNxgLink(b.NxgLnk)
+			if err != nil {
+				return nil, err
+			}
+			item.Header, item.Title, item.Priority, item.Profile = link.Header, link.Title, link.Priority, link.Profile
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// moveWatchFile moves the file to the subfolder of its folder and returns the new path
+// existing files are not overwritten, the time is added to the name instead
+func moveWatchFile(file string, folder string) (string, error) {
+	dir := filepath.Join(filepath.Dir(file), folder)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(file))
+	if _, err := os.Stat(target); err == nil {
+		target = filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+filepath.Base(file))
+	}
+	return target, os.Rename(file, target)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type ActiveConnections struct {
+	mu    sync.Mutex
+	conns map[int]*safeConn
+}
+
+func (a *ActiveConnections) set(connNumber int, conn *safeConn) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conns == nil {
+		a.conns = make(map[int]*safeConn)
+	}
+	a.conns[connNumber] = conn
+}
+
+func (a *ActiveConnections) remove(connNumber int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.conns, connNumber)
+}
+
+// check returns the number of stalled connections and aborts the
+// connections that did not receive any data for longer than conf.ReadTimeout
+func (a *ActiveConnections) check() (stalled int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for connNumber, conn := range a.conns {
+		idle := conn.stalledFor()
+		if conf.ReadTimeout > 0 && idle > time.Duration(conf.ReadTimeout) {
+			// the read deadline should already have fired, so make sure the read is aborted
+			Log.Warn("Connection %d received no data for %v, aborting", connNumber, idle.Round(time.Second))
+			conn.netConn.Close()
+		}
+		if conf.StallTime > 0 && idle > time.Duration(conf.StallTime) {
+			stalled++
+		}
+	}
+	return stalled
+}
+
+var activeConnections ActiveConnections
+
+// connectionWatchdog reports stalled connections until stop is closed
+func connectionWatchdog(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastStalled := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			stalled := activeConnections.check()
+			if stalled == lastStalled {
+				continue
+			}
+			if stalled > 0 {
+				Log.Warn("%d of %d connections stalled (no data for more than %v)", stalled, totalConnections(), conf.StallTime)
+			} else {
+				Log.Debug("No more stalled connections")
+			}
+			if stalled > 0 {
+				progress.describe(fmt.Sprintf("%-28s", fmt.Sprintf("INFO:    Downloading (%d stalled)", stalled)))
+			} else {
+				progress.describe(progressDescription)
+			}
+			lastStalled = stalled
+		}
+	}
+}